@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bots are programs that play a seat. They can be written in any language and
+// talk to the engine with lines of text on their standard input and output:
+//
+//   engine: machikoro 1            once, the protocol version
+//   engine: seat <n>               once, the player the bot plays
+//   bot:    ready                  once, within the decision timeout
+//
+// For every decision of the player, the engine sends the events since the
+// last decision, the state of the game as JSON and the decision request as
+// JSON, which has the kind of decision (bool, choice or text), the prompt and
+// the legal choices:
+//
+//   engine: event <text>           zero or more
+//   engine: state <json>
+//   engine: decide <id> <json>
+//   bot:    decision <id> <value>
+//
+// The value is the value of one of the choices, "yes" or "no" for a bool and
+// the rest of the line for a text. "none" skips an optional choice. At the
+// end of the game the engine sends "quit".
+//
+// A bot that doesn't answer within the timeout, answers with an illegal
+// decision or has crashed gets a default decision: no, or the first choice.
+// Lines other than decisions, like debug output of the bot, are ignored.
+
+const botProtocolVersion = 1
+
+// defaultBotTimeout is how long a bot can think about a decision.
+const defaultBotTimeout = 5 * time.Second
+
+type botPlayer struct {
+	Seat    int
+	Command string
+	Timeout time.Duration
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	lines  chan string
+	events []string
+	dead   bool
+	lastID int
+}
+
+// botFlags are the --bot flags, each a seat and a command like
+// "1=./mybot --level 3".
+type botFlags []string
+
+func (f *botFlags) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *botFlags) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func parseBotFlag(value string) (int, string, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+		return 0, "", fmt.Errorf("Invalid bot '%s', use <seat>=<command>", value)
+	}
+
+	seat, err := strconv.Atoi(parts[0])
+	if err != nil || seat < 0 || seat > 3 {
+		return 0, "", fmt.Errorf("Invalid bot seat '%s', seats are 0 - 3", parts[0])
+	}
+
+	return seat, parts[1], nil
+}
+
+// startBot starts the bot and waits until it is ready.
+func startBot(seat int, command string, timeout time.Duration) (*botPlayer, error) {
+	args := strings.Fields(command)
+	b := &botPlayer{
+		Seat:    seat,
+		Command: command,
+		Timeout: timeout,
+		cmd:     exec.Command(args[0], args[1:]...),
+		lines:   make(chan string, 16),
+	}
+	b.cmd.Stderr = os.Stderr
+
+	stdin, err := b.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	b.stdin = stdin
+	stdout, err := b.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = b.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Could not start the bot for seat %d: %s", seat, err)
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			b.lines <- scanner.Text()
+		}
+		close(b.lines)
+	}()
+
+	b.send("machikoro %d", botProtocolVersion)
+	b.send("seat %d", seat)
+	if _, ok := b.await("ready"); !ok {
+		b.Close()
+		return nil, fmt.Errorf("The bot for seat %d did not get ready", seat)
+	}
+
+	return b, nil
+}
+
+// send writes a line to the bot. A bot that stops reading would block the
+// game once the pipe is full, so a write that takes longer than the timeout
+// kills the bot.
+func (b *botPlayer) send(format string, a ...interface{}) {
+	if b.dead {
+		return
+	}
+
+	line := fmt.Sprintf(format+"\n", a...)
+	written := make(chan error, 1)
+	go func() {
+		_, err := io.WriteString(b.stdin, line)
+		written <- err
+	}()
+
+	select {
+	case err := <-written:
+		if err != nil {
+			b.crashed(err)
+		}
+	case <-time.After(b.Timeout):
+		b.crashed(fmt.Errorf("The bot stopped reading for %s", b.Timeout))
+		b.cmd.Process.Kill()
+	}
+}
+
+func (b *botPlayer) crashed(err error) {
+	if b.dead {
+		return
+	}
+
+	b.dead = true
+	log.Printf("Bot for seat %d (%s) crashed: %s", b.Seat, b.Command, err)
+}
+
+// await waits for a line starting with the prefix, and returns the rest of
+// it.
+func (b *botPlayer) await(prefix string) (string, bool) {
+	if b.dead {
+		return "", false
+	}
+
+	timeout := time.After(b.Timeout)
+	for {
+		select {
+		case line, ok := <-b.lines:
+			if !ok {
+				b.crashed(fmt.Errorf("The bot exited"))
+				return "", false
+			}
+			if line == prefix {
+				return "", true
+			}
+			if strings.HasPrefix(line, prefix+" ") {
+				return line[len(prefix)+1:], true
+			}
+		case <-timeout:
+			log.Printf("Bot for seat %d (%s) timed out after %s", b.Seat, b.Command, b.Timeout)
+			return "", false
+		}
+	}
+}
+
+// decide asks the bot for a decision, and makes the default decision when it
+// doesn't give a legal one.
+func (b *botPlayer) decide(req decisionRequest) string {
+	return b.decideState(req, gameSnapshot())
+}
+
+// decideState is decide for a game with the state, which is not the game of
+// this process when the bot plays for a player of the game server.
+func (b *botPlayer) decideState(req decisionRequest, snapshot gameState) string {
+	b.lastID++
+	id := b.lastID
+
+	for _, event := range b.events {
+		b.send("event %s", event)
+	}
+	b.events = nil
+
+	state, _ := json.Marshal(snapshot)
+	request, _ := json.Marshal(req)
+	b.send("state %s", state)
+	b.send("decide %d %s", id, request)
+
+	for {
+		reply, ok := b.await("decision")
+		if !ok {
+			return defaultDecision(req)
+		}
+
+		// Late answers to decisions that timed out are skipped.
+		fields := strings.SplitN(reply, " ", 2)
+		if replyID, err := strconv.Atoi(fields[0]); err != nil || replyID != id {
+			continue
+		}
+
+		var value string
+		if len(fields) == 2 {
+			value = fields[1]
+		}
+		answer, err := botAnswer(req, value)
+		if err != nil {
+			log.Printf("Bot for seat %d (%s) made an illegal decision: %s", b.Seat, b.Command, err)
+			return defaultDecision(req)
+		}
+
+		return answer
+	}
+}
+
+// botAnswer turns the value of a decision into the line a player would type.
+func botAnswer(req decisionRequest, value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	switch req.Kind {
+	case textDecision:
+		return value, nil
+	case boolDecision:
+		switch strings.ToLower(value) {
+		case "yes", "y", "1":
+			return "y", nil
+		case "no", "n", "0":
+			return "n", nil
+		}
+	default:
+		if value == "none" && req.Optional {
+			return "", nil
+		}
+		for _, choice := range req.Choices {
+			if strconv.Itoa(choice.Value) == value {
+				return value, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("'%s' is not a legal %s decision", value, req.Kind)
+}
+
+// defaultDecision is a legal decision for any request. Optional choices are
+// not skipped, because some prompts ask again until a choice is made.
+func defaultDecision(req decisionRequest) string {
+	switch req.Kind {
+	case boolDecision:
+		return "n"
+	case choiceDecision:
+		if len(req.Choices) > 0 {
+			return strconv.Itoa(req.Choices[0].Value)
+		}
+	}
+
+	return ""
+}
+
+func (b *botPlayer) Close() {
+	b.send("quit")
+	b.stdin.Close()
+
+	done := make(chan struct{})
+	go func() {
+		b.cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(b.Timeout):
+		b.cmd.Process.Kill()
+	}
+}
+
+// botSeats lets bots make the decisions of their seats, and the players make
+// the other decisions. All decisions during a turn are made by the player who
+// rolled the dice.
+type botSeats struct {
+	Bots  map[int]*botPlayer
+	human func(req decisionRequest) string
+	// pending is the unfinished line of the output, the prompt.
+	pending string
+}
+
+func startBots(flags botFlags, timeout time.Duration) (*botSeats, error) {
+	seats := &botSeats{Bots: make(map[int]*botPlayer)}
+
+	for _, value := range flags {
+		seat, command, err := parseBotFlag(value)
+		if err != nil {
+			seats.Close()
+			return nil, err
+		}
+		if _, ok := seats.Bots[seat]; ok {
+			seats.Close()
+			return nil, fmt.Errorf("Seat %d has more than one bot", seat)
+		}
+
+		b, err := startBot(seat, command, timeout)
+		if err != nil {
+			seats.Close()
+			return nil, err
+		}
+		seats.Bots[seat] = b
+	}
+
+	seats.human = decide
+	decide = seats.decide
+	output = io.MultiWriter(output, seats)
+
+	return seats, nil
+}
+
+// Write collects the events for the bots.
+func (s *botSeats) Write(b []byte) (int, error) {
+	lines := strings.Split(s.pending+string(b), "\n")
+	for _, line := range lines[:len(lines)-1] {
+		for _, bot := range s.Bots {
+			bot.events = append(bot.events, line)
+		}
+	}
+	s.pending = lines[len(lines)-1]
+
+	return len(b), nil
+}
+
+func (s *botSeats) decide(req decisionRequest) string {
+	if currentTurn == nil {
+		return s.human(req)
+	}
+	bot, ok := s.Bots[currentTurn.Roller.ID]
+	if !ok {
+		return s.human(req)
+	}
+
+	req.Prompt = strings.TrimSpace(strings.TrimSuffix(s.pending, "(y/n) "))
+	answer := bot.decide(req)
+	fmt.Fprintln(output, answer)
+
+	return answer
+}
+
+func (s *botSeats) Close() {
+	for _, bot := range s.Bots {
+		bot.Close()
+	}
+}
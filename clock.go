@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Games of the game server can have a time control: a limit for each
+// decision like "30s", or a bank of time for each player with an increment at
+// the start of each of their turns like "10m+5s". When the time of a decision
+// runs out, the default decision is made for the player: no, or the first
+// choice. The clocks are sent to everyone with each decision.
+
+type timeControl struct {
+	PerDecision time.Duration
+	Bank        time.Duration
+	Increment   time.Duration
+}
+
+// parseTimeControl reads "30s" as a limit per decision and "10m+5s" as a bank
+// with an increment. An empty spec is no time control.
+func parseTimeControl(spec string) (*timeControl, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	parts := strings.SplitN(spec, "+", 2)
+	first, err := time.ParseDuration(parts[0])
+	if err != nil || first <= 0 {
+		return nil, fmt.Errorf("Invalid time control '%s', use a time per decision like 30s or a bank with an increment like 10m+5s", spec)
+	}
+	if len(parts) == 1 {
+		return &timeControl{PerDecision: first}, nil
+	}
+
+	increment, err := time.ParseDuration(parts[1])
+	if err != nil || increment < 0 {
+		return nil, fmt.Errorf("Invalid increment '%s' of the time control", parts[1])
+	}
+
+	return &timeControl{Bank: first, Increment: increment}, nil
+}
+
+func (tc timeControl) String() string {
+	if tc.Bank > 0 {
+		return tc.Bank.String() + "+" + tc.Increment.String()
+	}
+
+	return tc.PerDecision.String()
+}
+
+// gameClock is the time control of a game and the time the players have
+// left. It is guarded by the lock of the game.
+type gameClock struct {
+	control   timeControl
+	remaining []time.Duration
+	// seat is the player whose clock runs for the decision, or -1.
+	seat     int
+	decision int
+	started  time.Time
+	limit    time.Duration
+	timer    *time.Timer
+}
+
+// clockStatus is the clock as it is shown to the players, in seconds.
+type clockStatus struct {
+	Control string `json:"control"`
+	// Remaining is the time in the bank of each seat.
+	Remaining []float64 `json:"remaining,omitempty"`
+	// Seat is the player who is deciding on the clock, and Deadline the time
+	// they have left for the decision.
+	Seat     int     `json:"seat"`
+	Deadline float64 `json:"deadline,omitempty"`
+}
+
+func newGameClock(control timeControl, seats int) *gameClock {
+	c := &gameClock{control: control, seat: -1}
+	if control.Bank > 0 {
+		for i := 0; i < seats; i++ {
+			c.remaining = append(c.remaining, control.Bank)
+		}
+	}
+
+	return c
+}
+
+func seconds(d time.Duration) float64 {
+	return math.Round(d.Seconds()*10) / 10
+}
+
+// startClock starts the clock of the player of the open decision. It is
+// called with the lock held.
+func (g *serverGame) startClock() {
+	c := g.clock
+	if c == nil || g.decision == nil || g.decision.Seat == nil || *g.decision.Seat < 0 {
+		return
+	}
+	seat := *g.decision.Seat
+	if g.seats[seat].Away {
+		return
+	}
+
+	limit := c.control.PerDecision
+	if c.control.Bank > 0 {
+		limit = c.remaining[seat]
+	}
+
+	id := g.decision.ID
+	c.seat = seat
+	c.decision = id
+	c.started = time.Now()
+	c.limit = limit
+	c.timer = time.AfterFunc(limit, func() {
+		g.clockTimeout(id)
+	})
+}
+
+// stopClock stops the clock of the player, who made the decision. It is
+// called with the lock held.
+func (g *serverGame) stopClock() {
+	c := g.clock
+	if c == nil || c.seat == -1 {
+		return
+	}
+
+	c.timer.Stop()
+	if c.control.Bank > 0 {
+		c.remaining[c.seat] -= time.Since(c.started)
+		if c.remaining[c.seat] < 0 {
+			c.remaining[c.seat] = 0
+		}
+	}
+	c.seat = -1
+}
+
+// clockTimeout makes the default decision when the time for the decision has
+// run out.
+func (g *serverGame) clockTimeout(id int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.decision == nil || g.decision.ID != id || g.clock.decision != id || g.clock.seat == -1 {
+		return
+	}
+
+	g.addEvent(fmt.Sprintf("Player %d ran out of time.", g.clock.seat))
+	req := *g.decision.decisionRequest
+	value, _, err := lineDecision(req, defaultDecision(req))
+	if err != nil {
+		value = nil
+	}
+	g.send(id, value)
+}
+
+// startTurnClock gives the player the increment at the start of their turn.
+// It is called with the lock held.
+func (g *serverGame) startTurnClock(seat int) {
+	if g.clock == nil || g.clock.control.Increment == 0 {
+		return
+	}
+
+	// Bots of the engine decide without the clock of the server.
+	if seat >= 0 && seat < len(g.clock.remaining) && g.seats[seat].Bot == "" {
+		g.clock.remaining[seat] += g.clock.control.Increment
+	}
+}
+
+// clockStatus is the state of the clock for the players. It is called with the
+// lock held.
+func (g *serverGame) clockStatus() *clockStatus {
+	c := g.clock
+	if c == nil {
+		return nil
+	}
+
+	status := &clockStatus{Control: c.control.String(), Seat: c.seat}
+	elapsed := time.Duration(0)
+	if c.seat != -1 {
+		elapsed = time.Since(c.started)
+		status.Deadline = seconds(c.limit - elapsed)
+	}
+	for i, remaining := range c.remaining {
+		if i == c.seat {
+			remaining -= elapsed
+		}
+		if remaining < 0 {
+			remaining = 0
+		}
+		status.Remaining = append(status.Remaining, seconds(remaining))
+	}
+
+	return status
+}
@@ -127,7 +127,7 @@ func (c *coinSet) TransferTo(amount int, receiver *coinSet) int {
 	if remainder > 0 && remainder <= c.Total() {
 		ok := c.TradeWithBank()
 		if !ok {
-			fmt.Println("Failed to trade coins with bank.")
+			fmt.Fprintln(output, "Failed to trade coins with bank.")
 			return remainder
 		}
 		return c.TransferTo(remainder, receiver)
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// command is a subcommand of the program, run instead of a game when its name
+// is the first argument.
+type command struct {
+	Description string
+	Run         func(args []string) error
+}
+
+var commands = map[string]command{
+	"companion": command{
+		Description: "Keep the score of a game on a real table, entering the dice and the cards drawn",
+		Run:         runCompanion,
+	},
+	"history": command{
+		Description: "List the finished games, with --player, --version and --winner, or replay one with replay <game>",
+		Run:         runHistory,
+	},
+	"lint-cards": command{
+		Description: "Check the card data of all card sets and versions, or of the named one",
+		Run:         runLintCards,
+	},
+	"play-file": command{
+		Description: "Play the next move of a game kept in a file, or start one, with --commit-reveal for dice nobody controls",
+		Run:         runPlayByFile,
+	},
+	"profiles": command{
+		Description: "List the player profiles with their games and wins, or add one with add <name>",
+		Run:         runProfiles,
+	},
+	"ratings": command{
+		Description: "Show the Glicko-2 leaderboard of each version, with --version and --recent",
+		Run:         runRatings,
+	},
+	"resume": command{
+		Description: "Go on with a game saved with the save command, from the save file or the given one",
+		Run:         runResume,
+	},
+	"scenarios": command{
+		Description: "Run the rules scenarios in a directory",
+		Run:         runScenarios,
+	},
+	"serve": command{
+		Description: "Host games over HTTP, with --addr and --bot name=command",
+		Run:         runServe,
+	},
+	"serve-tcp": command{
+		Description: "Host a lobby for nc and telnet, with --addr and --bot name=command",
+		Run:         runServeTCP,
+	},
+	"tui": command{
+		Description: "Play a game in a full-screen terminal interface",
+		Run:         runTUI,
+	},
+}
+
+// runCommand runs the command named by the arguments. It reports false when
+// there is no command to run.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(output, "Unknown command '%s'\n", args[0])
+		for name, cmd := range commands {
+			fmt.Fprintf(output, "  %s: %s\n", name, cmd.Description)
+		}
+		os.Exit(1)
+	}
+
+	if err := cmd.Run(args[1:]); err != nil {
+		fmt.Fprintln(output, err)
+		os.Exit(1)
+	}
+
+	return true
+}
+
+func runLintCards(args []string) error {
+	var name string
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	presets, err := loadVersionPresets()
+	if err != nil {
+		fmt.Fprintln(output, err)
+	}
+	for _, preset := range presets {
+		if err := preset.Validate(); err != nil {
+			fmt.Fprintf(output, "error: %s: (preset): %s\n", preset.Name, err)
+			continue
+		}
+		registerGameVersion(preset.GameVersion())
+	}
+
+	var problems []lintProblem
+	found := false
+
+	for _, set := range cardSetsSorted {
+		if name != "" && set.Name != name {
+			continue
+		}
+		found = true
+		problems = append(problems, lintCardSet(set)...)
+	}
+	for _, version := range gameVersionsSorted {
+		if name != "" && version.Name != name {
+			continue
+		}
+		found = true
+		problems = append(problems, lintGameVersion(version)...)
+	}
+
+	if !found {
+		return fmt.Errorf("Unknown card set or version '%s'", name)
+	}
+
+	errorCount := 0
+	for _, problem := range problems {
+		fmt.Fprintln(output, problem)
+		if !problem.Warning {
+			errorCount++
+		}
+	}
+	fmt.Fprintf(output, "%d errors, %d warnings\n", errorCount, len(problems)-errorCount)
+
+	if errorCount > 0 {
+		return errors.New("The card data has errors")
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+// Commit-reveal dice are dice that nobody controls alone, not even whoever
+// runs the game. Before the first draw every player commits to a hash chain:
+// they keep a secret, hash it diceChainLength times and publish the last
+// hash. For each draw, a roll of the dice or a card drawn for the market,
+// every player reveals the hash before the one they revealed last, which
+// anyone can check by hashing it. The draw is the hash of all the values
+// revealed for it. A player can't choose their values after seeing the
+// values of the others, because they are committed to, and can't know the
+// values of the others before they are revealed.
+//
+// The commitments and the reveals are the transcript of the dice, which
+// checks out after the game with verify.
+
+// diceChainLength is how many draws a game can make.
+const diceChainLength = 10000
+
+type commitRevealDice struct {
+	// Commitments is the last hash of the chain of each seat.
+	Commitments []string `json:"commitments"`
+	// Reveals are the values of each seat for each draw.
+	Reveals [][]string `json:"reveals"`
+	// Faces are the faces of the dice, 6 when not set.
+	Faces int `json:"faces,omitempty"`
+
+	// commit and reveal get the commitment of a seat, and its value for a
+	// draw, when they are not in the transcript yet. They return nothing when
+	// the player has yet to give them.
+	commit func(seat int) string
+	reveal func(seat, draw int) string
+	draws  int
+	// special is the special roll of the last roll of the dice. Each turn
+	// rolls both, so they come from the same draw.
+	special []int
+}
+
+// transcriptError is the panic used when a value doesn't check out.
+type transcriptError struct {
+	err error
+}
+
+// diceWaiting is the panic used when a player has yet to commit to or reveal
+// their dice.
+type diceWaiting struct {
+	seat int
+	what string
+}
+
+func newCommitRevealDice(seats, faces int) *commitRevealDice {
+	return &commitRevealDice{Commitments: make([]string, seats), Faces: faces}
+}
+
+func (d *commitRevealDice) faces() int {
+	if d.Faces == 0 {
+		return 6
+	}
+
+	return d.Faces
+}
+
+// newDiceSecret makes the secret a player keeps for their chain.
+func newDiceSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+func hashValue(value string) string {
+	b, err := hex.DecodeString(value)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// chainValue is the value of the chain of the secret for the draw. The
+// commitment is the value for draw -1.
+func chainValue(secret string, draw int) string {
+	value := secret
+	for i := draw + 1; i < diceChainLength; i++ {
+		value = hashValue(value)
+	}
+
+	return value
+}
+
+// install makes the dice, the special rolls and the market draws use the
+// commit-reveal dice.
+func (d *commitRevealDice) install() {
+	gameDice = fairDice{Faces: d.faces()}
+	rollDice = d.roll
+	rollSpecial = d.rollSpecial
+	drawIndex = d.intn
+}
+
+// checkValue checks the value of the seat for the draw against the value
+// before it in the chain.
+func (d *commitRevealDice) checkValue(seat, draw int) error {
+	prior := d.Commitments[seat]
+	if draw > 0 {
+		prior = d.Reveals[draw-1][seat]
+	}
+	if hashValue(d.Reveals[draw][seat]) != prior {
+		return fmt.Errorf("The value of player %d for draw %d does not match their commitment", seat, draw+1)
+	}
+
+	return nil
+}
+
+// next is the hash of the next draw. The values that are not in the
+// transcript yet are asked for.
+func (d *commitRevealDice) next() []byte {
+	for seat, commitment := range d.Commitments {
+		if commitment == "" {
+			d.Commitments[seat] = d.commit(seat)
+		}
+	}
+	for seat, commitment := range d.Commitments {
+		if commitment == "" {
+			panic(diceWaiting{seat: seat, what: "commit to"})
+		}
+	}
+
+	draw := d.draws
+	if draw >= diceChainLength {
+		panic(transcriptError{fmt.Errorf("The game made more than %d draws", diceChainLength)})
+	}
+	if draw == len(d.Reveals) {
+		d.Reveals = append(d.Reveals, make([]string, len(d.Commitments)))
+	}
+	for seat, value := range d.Reveals[draw] {
+		if value == "" {
+			d.Reveals[draw][seat] = d.reveal(seat, draw)
+		}
+	}
+	for seat, value := range d.Reveals[draw] {
+		if value == "" {
+			panic(diceWaiting{seat: seat, what: "reveal"})
+		}
+		if err := d.checkValue(seat, draw); err != nil {
+			panic(transcriptError{err})
+		}
+	}
+	d.draws++
+
+	h := sha256.New()
+	h.Write([]byte(strconv.Itoa(draw)))
+	for _, value := range d.Reveals[draw] {
+		h.Write([]byte(value))
+	}
+
+	return h.Sum(nil)
+}
+
+// intn is a number from 0 to n-1 of the next draw. The bias of the modulo is
+// too small to matter.
+func (d *commitRevealDice) intn(n int) int {
+	return int(binary.BigEndian.Uint64(d.next()) % uint64(n))
+}
+
+// dice are the dice of the hash of a draw, each from its own part of the
+// hash. A hash has enough for 4 dice.
+func dice(sum []byte, count, faces int) []int {
+	var dice []int
+	for i := 0; i < count; i++ {
+		dice = append(dice, int(binary.BigEndian.Uint64(sum[i*8:])%uint64(faces))+1)
+	}
+
+	return dice
+}
+
+func (d *commitRevealDice) roll(dieCount int) []int {
+	sum := d.next()
+	d.special = dice(sum[16:], 2, d.faces())
+
+	return dice(sum, dieCount, d.faces())
+}
+
+func (d *commitRevealDice) rollSpecial() int {
+	special := d.special
+	d.special = nil
+	if special == nil {
+		special = dice(d.next(), 2, d.faces())
+	}
+
+	return special[0] + special[1]
+}
+
+// verify checks the whole transcript, without playing the game.
+func (d *commitRevealDice) verify() error {
+	for draw, values := range d.Reveals {
+		if len(values) != len(d.Commitments) {
+			return fmt.Errorf("Draw %d has %d values for %d players", draw+1, len(values), len(d.Commitments))
+		}
+		for seat, value := range values {
+			if value == "" && draw == len(d.Reveals)-1 {
+				continue
+			}
+			if err := d.checkValue(seat, draw); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
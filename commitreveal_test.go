@@ -0,0 +1,142 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChainValue(t *testing.T) {
+	secret, err := newDiceSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := chainValue(secret, diceChainLength-1); got != secret {
+		t.Errorf("The value of the last draw is %s, want the secret", got)
+	}
+	for _, draw := range []int{0, 1, 2, 500} {
+		if hashValue(chainValue(secret, draw)) != chainValue(secret, draw-1) {
+			t.Errorf("The hash of the value of draw %d is not the value of the draw before", draw)
+		}
+	}
+	if hashValue("not hex") != "" {
+		t.Error("A value that is not hex has a hash")
+	}
+}
+
+// testDice are commit-reveal dice of players with the secrets, which commit
+// and reveal as soon as they are asked to.
+func testDice(secrets []string, faces int) *commitRevealDice {
+	d := newCommitRevealDice(len(secrets), faces)
+	d.commit = func(seat int) string {
+		return chainValue(secrets[seat], -1)
+	}
+	d.reveal = func(seat, draw int) string {
+		return chainValue(secrets[seat], draw)
+	}
+
+	return d
+}
+
+func TestCommitRevealDice(t *testing.T) {
+	secrets := []string{"01", "02", "03"}
+
+	d := testDice(secrets, 8)
+	var rolls [][]int
+	var specials []int
+	for i := 0; i < 20; i++ {
+		roll := d.roll(2)
+		for _, die := range roll {
+			if die < 1 || die > 8 {
+				t.Fatalf("Roll %d has a die of %d", i+1, die)
+			}
+		}
+		rolls = append(rolls, roll)
+		specials = append(specials, d.rollSpecial())
+	}
+	if err := d.verify(); err != nil {
+		t.Fatalf("The transcript doesn't verify: %s", err)
+	}
+	if len(d.Reveals) != 20 {
+		t.Errorf("20 rolls made %d draws, want 20", len(d.Reveals))
+	}
+
+	// The transcript alone rolls the same dice.
+	replay := &commitRevealDice{Commitments: d.Commitments, Reveals: d.Reveals, Faces: 8}
+	for i := range rolls {
+		if roll := replay.roll(2); !reflect.DeepEqual(roll, rolls[i]) {
+			t.Errorf("Roll %d of the replay is %v, want %v", i+1, roll, rolls[i])
+		}
+		if special := replay.rollSpecial(); special != specials[i] {
+			t.Errorf("Special roll %d of the replay is %d, want %d", i+1, special, specials[i])
+		}
+	}
+}
+
+func TestCommitRevealVerify(t *testing.T) {
+	secrets := []string{"0a", "0b"}
+	played := testDice(secrets, 6)
+	for i := 0; i < 5; i++ {
+		played.roll(1)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(d *commitRevealDice)
+		ok     bool
+	}{
+		{name: "as played", tamper: func(d *commitRevealDice) {}, ok: true},
+		{name: "missing last value", tamper: func(d *commitRevealDice) {
+			d.Reveals[4][1] = ""
+		}, ok: true},
+		{name: "changed reveal", tamper: func(d *commitRevealDice) {
+			d.Reveals[2][0] = chainValue("0c", 2)
+		}},
+		{name: "changed commitment", tamper: func(d *commitRevealDice) {
+			d.Commitments[1] = chainValue("0c", -1)
+		}},
+		{name: "swapped draws", tamper: func(d *commitRevealDice) {
+			d.Reveals[1], d.Reveals[2] = d.Reveals[2], d.Reveals[1]
+		}},
+		{name: "missing value before the last draw", tamper: func(d *commitRevealDice) {
+			d.Reveals[3][0] = ""
+		}},
+		{name: "missing player", tamper: func(d *commitRevealDice) {
+			d.Reveals[0] = d.Reveals[0][:1]
+		}},
+	}
+
+	for _, test := range tests {
+		d := &commitRevealDice{Commitments: append([]string{}, played.Commitments...)}
+		for _, values := range played.Reveals {
+			d.Reveals = append(d.Reveals, append([]string{}, values...))
+		}
+		test.tamper(d)
+
+		err := d.verify()
+		if test.ok && err != nil {
+			t.Errorf("%s: verify returned error: %s", test.name, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: verify did not find the change", test.name)
+		}
+	}
+}
+
+func TestCommitRevealWaiting(t *testing.T) {
+	d := testDice([]string{"01", "02"}, 6)
+	d.reveal = func(seat, draw int) string {
+		if seat == 1 {
+			return ""
+		}
+		return chainValue("01", draw)
+	}
+
+	defer func() {
+		waiting, ok := recover().(diceWaiting)
+		if !ok || waiting.seat != 1 || waiting.what != "reveal" {
+			t.Errorf("Rolling without a reveal of player 1 did not wait for it, got %v", waiting)
+		}
+	}()
+	d.roll(2)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// In companion mode the game is played on a real table, and the program keeps
+// the score and referees the rules. The dice rolled on the table and the cards
+// drawn for the market are entered instead of being rolled and drawn by the
+// program, which then pays out, keeps track of the coins and tells when a
+// purchase is not allowed.
+
+func runCompanion(args []string) error {
+	if len(args) != 0 {
+		return errors.New("Use companion, without arguments")
+	}
+
+	restore := saveGlobals()
+	defer restore()
+	setUpCompanion()
+	decide = companionDecide
+
+	err := playMatch(companionMode)
+	if err == errGameQuit {
+		fmt.Fprintln(output, "Bye!")
+		return nil
+	}
+
+	return err
+}
+
+// companionMode is the mode of the games played in companion mode.
+const companionMode = "companion"
+
+// setUpCompanion makes the dice and the draws of the market be entered.
+func setUpCompanion() {
+	gameDice = manualDice{Faces: diceFaces(gameDice)}
+	rollSpecial = companionRollSpecial
+	drawFrom = companionDraw
+}
+
+// companionRollSpecial asks for the special roll only when a card of the roll
+// pays out by it.
+func companionRollSpecial() int {
+	for _, card := range market.FindByRoll(currentTurn.Roll) {
+		if !card.Effect.SpecialRoll {
+			continue
+		}
+		for _, p := range plrs {
+			if pc, ok := p.SupplyCards[card.Name]; ok && pc.Total > 0 {
+				fmt.Fprintf(output, "Player %d rolls 2 dice for %s. ", currentTurn.Roller.ID, card.Name)
+				return rollSpecialDice()
+			}
+		}
+	}
+
+	return 0
+}
+
+// companionDraw asks which card was drawn from the deck on the table.
+func companionDraw(names []string) int {
+	var choices []int
+	fmt.Fprintln(output, "The market is missing a card.")
+	printMenu("In the deck are:")
+	for i, name := range names {
+		choices = append(choices, i+1)
+		printMenu("  (%d) %s", i+1, name)
+	}
+
+	for {
+		fmt.Fprint(output, "Which card was drawn? ")
+		idx, err := promptChoice(choices, names)
+		if err == nil {
+			return idx - 1
+		}
+	}
+}
+
+// companionDecide answers the prompts from the input, and tells why a card
+// that is asked for can't be bought.
+func companionDecide(req decisionRequest) string {
+	for {
+		line := decideByLine(req)
+		reason := purchaseViolation(req, line)
+		if reason == "" {
+			return line
+		}
+		fmt.Fprintf(output, "Not allowed: %s. Try again: ", reason)
+	}
+}
+
+// purchaseViolation is the reason the card of the answer to a purchase can't
+// be bought, or nothing when it can be bought or the prompt is not for a
+// purchase.
+func purchaseViolation(req decisionRequest, line string) string {
+	if req.Kind != choiceDecision || line == "" || currentTurn == nil {
+		return ""
+	}
+
+	var labels []string
+	for _, choice := range req.Choices {
+		labels = append(labels, choice.Label)
+	}
+	rlr := currentTurn.Roller
+	coins := rlr.Coins.Total()
+
+	switch {
+	case sameNames(labels, inStockNames()):
+		var names []string
+		for _, card := range market.Cards {
+			names = append(names, card.Name)
+		}
+		name := chosenName(req, line, names)
+		if name == "" {
+			return ""
+		}
+		card, ok := market.FindByName(name)
+		if !ok {
+			return fmt.Sprintf("%s is not a card of this version", name)
+		}
+		if indexOf(labels, name) == -1 {
+			if card.Supply == 0 {
+				return fmt.Sprintf("there are no %s left", name)
+			}
+			return fmt.Sprintf("%s is not on the market", name)
+		}
+		if coins < card.Cost {
+			return fmt.Sprintf("player %d has %d coins and %s costs %d", rlr.ID, coins, name, card.Cost)
+		}
+	case sameNames(labels, landmarkNames(market.EachLandmark(rlr))):
+		name := chosenName(req, line, landmarkNames(market.LandmarkCards))
+		if name == "" {
+			return ""
+		}
+		landmark, _ := market.FindLandmark(name)
+		switch {
+		case rlr.HasLandmark(name):
+			return fmt.Sprintf("player %d already has %s", rlr.ID, name)
+		case indexOf(labels, name) == -1:
+			return fmt.Sprintf("%s is not on the market", name)
+		case !landmark.CanBuild(rlr):
+			return fmt.Sprintf("player %d can't build %s. %s", rlr.ID, name, landmark.Prereq.Desc)
+		case coins < landmark.CostFor(rlr):
+			return fmt.Sprintf("player %d has %d coins and %s costs %d", rlr.ID, coins, name, landmark.CostFor(rlr))
+		}
+	}
+
+	return ""
+}
+
+// chosenName is the name of the card of the answer, by its number among the
+// choices or by its name among all the cards.
+func chosenName(req decisionRequest, line string, names []string) string {
+	if n, err := strconv.Atoi(line); err == nil {
+		for _, choice := range req.Choices {
+			if choice.Value == n {
+				return choice.Label
+			}
+		}
+		return ""
+	}
+
+	idx, err := matchName(line, names)
+	if err != nil {
+		return ""
+	}
+
+	return names[idx]
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func inStockNames() []string {
+	var names []string
+	for _, cardCount := range market.Query().InStock().SortBy(byActiveNumber).Counts() {
+		names = append(names, cardCount.Card.Name)
+	}
+
+	return names
+}
+
+func landmarkNames(landmarks []landmarkCard) []string {
+	var names []string
+	for _, landmark := range landmarks {
+		names = append(names, landmark.Name)
+	}
+
+	return names
+}
+
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
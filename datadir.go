@@ -0,0 +1,21 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// dataDir is where presets and other local data are stored. It can be moved
+// with the MACHI_KORO_DATA environment variable.
+func dataDir() (string, error) {
+	if dir := os.Getenv("MACHI_KORO_DATA"); dir != "" {
+		return dir, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "machi_koro"), nil
+}
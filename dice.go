@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Dice are the dice of the game. Besides fair six-sided dice there are dice
+// with more faces, weighted dice, seeded dice that roll the same in every
+// game, scripted dice for scenarios and manual dice for games on a real
+// table. The chances of the faces are what the forecast and the check of the
+// card data work with.
+type Dice interface {
+	// Roll rolls the dice and returns the face of each.
+	Roll(count int) []int
+	// Chances are the chances of the faces of a die, the first for face 1.
+	Chances() []float64
+}
+
+// fairDice are dice with faces that are equally likely. Without a source of
+// their own they roll with the random numbers of the game.
+type fairDice struct {
+	Faces int
+	src   *rand.Rand
+}
+
+func (d fairDice) Roll(count int) []int {
+	var dice []int
+	for i := 0; i < count; i++ {
+		dice = append(dice, intn(d.src, d.Faces)+1)
+	}
+
+	return dice
+}
+
+func (d fairDice) Chances() []float64 {
+	var chances []float64
+	for i := 0; i < d.Faces; i++ {
+		chances = append(chances, 1/float64(d.Faces))
+	}
+
+	return chances
+}
+
+// weightedDice are dice with faces that are more likely than others, by
+// their weights.
+type weightedDice struct {
+	Weights []float64
+	src     *rand.Rand
+}
+
+func (d weightedDice) Roll(count int) []int {
+	chances := d.Chances()
+
+	var dice []int
+	for i := 0; i < count; i++ {
+		x := rand.Float64()
+		if d.src != nil {
+			x = d.src.Float64()
+		}
+		face := len(chances)
+		for j, chance := range chances {
+			if x < chance {
+				face = j + 1
+				break
+			}
+			x -= chance
+		}
+		dice = append(dice, face)
+	}
+
+	return dice
+}
+
+func (d weightedDice) Chances() []float64 {
+	total := 0.0
+	for _, w := range d.Weights {
+		total += w
+	}
+
+	var chances []float64
+	for _, w := range d.Weights {
+		chances = append(chances, w/total)
+	}
+
+	return chances
+}
+
+func intn(src *rand.Rand, n int) int {
+	if src != nil {
+		return src.Intn(n)
+	}
+
+	return rand.Intn(n)
+}
+
+// seededDice are the dice rolling with a source of their own, so that they
+// roll the same in every game with the seed.
+func seededDice(d Dice, seed int64) Dice {
+	src := rand.New(rand.NewSource(seed))
+
+	switch d := d.(type) {
+	case fairDice:
+		d.src = src
+		return d
+	case weightedDice:
+		d.src = src
+		return d
+	}
+
+	return d
+}
+
+// scriptedDice roll the given dice, in order.
+type scriptedDice struct {
+	Faces int
+	rolls [][]int
+}
+
+// next is the next roll of the script.
+func (d *scriptedDice) next(count int) ([]int, error) {
+	if len(d.rolls) == 0 {
+		return nil, errors.New("The turn rolled more often than given")
+	}
+	dice := d.rolls[0]
+	d.rolls = d.rolls[1:]
+
+	if len(dice) != count {
+		return nil, fmt.Errorf("The turn rolled %d dice, but the scenario gives %d", count, len(dice))
+	}
+
+	return dice, nil
+}
+
+func (d *scriptedDice) Roll(count int) []int {
+	dice, err := d.next(count)
+	if err != nil {
+		panic(err)
+	}
+
+	return dice
+}
+
+func (d *scriptedDice) Chances() []float64 {
+	return fairDice{Faces: d.Faces}.Chances()
+}
+
+// manualDice are the dice rolled on a real table, which are entered.
+type manualDice struct {
+	Faces int
+}
+
+func (d manualDice) Roll(count int) []int {
+	fmt.Fprint(output, "Which dice were rolled? ")
+
+	for {
+		line := promptLine()
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ' ' || r == ','
+		})
+
+		var dice []int
+		for _, field := range fields {
+			die, err := strconv.Atoi(field)
+			if err != nil || die < 1 || die > d.Faces {
+				dice = nil
+				break
+			}
+			dice = append(dice, die)
+		}
+		if len(dice) == count {
+			return dice
+		}
+
+		if count == 1 {
+			fmt.Fprintf(output, "Enter the face of the die from 1 to %d, like 4: ", d.Faces)
+		} else {
+			fmt.Fprintf(output, "Enter the faces of the %d dice from 1 to %d, like 3 5: ", count, d.Faces)
+		}
+	}
+}
+
+func (d manualDice) Chances() []float64 {
+	return fairDice{Faces: d.Faces}.Chances()
+}
+
+// parseDice reads "d8" as fair dice with 8 faces, and "weighted=1,1,1,1,1,2"
+// as dice with the weights of their faces.
+func parseDice(spec string) (Dice, error) {
+	spec = strings.TrimSpace(strings.ToLower(spec))
+
+	if strings.HasPrefix(spec, "weighted=") {
+		var weights []float64
+		total := 0.0
+		for _, field := range strings.Split(strings.TrimPrefix(spec, "weighted="), ",") {
+			w, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil || w < 0 {
+				return nil, fmt.Errorf("Invalid weight '%s' of the dice", field)
+			}
+			weights = append(weights, w)
+			total += w
+		}
+		if len(weights) < 2 || total == 0 {
+			return nil, errors.New("Weighted dice need at least 2 faces that can be rolled")
+		}
+		return weightedDice{Weights: weights}, nil
+	}
+
+	if strings.HasPrefix(spec, "d") {
+		if faces, err := strconv.Atoi(spec[1:]); err == nil && faces >= 2 && faces <= 100 {
+			return fairDice{Faces: faces}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Invalid dice '%s', use d6, d8 or weighted=1,1,1,1,1,2", spec)
+}
+
+// diceFaces is the number of faces of the dice.
+func diceFaces(d Dice) int {
+	return len(d.Chances())
+}
+
+// rollWith rolls the dice and returns the roll, and if it was a double.
+func rollWith(d Dice, dieCount int) (int, bool) {
+	return sumRoll(d.Roll(dieCount))
+}
+
+// sumRoll is the roll of the faces of the dice, and if it was a double.
+func sumRoll(dice []int) (int, bool) {
+	r := 0
+	for _, die := range dice {
+		r += die
+	}
+
+	return r, len(dice) == 2 && dice[0] == dice[1]
+}
+
+// rollChances are the chances of each roll of the dice in use, for a number
+// of dice.
+func rollChances(dieCount int) map[int]float64 {
+	chances := map[int]float64{0: 1}
+	faces := gameDice.Chances()
+
+	for i := 0; i < dieCount; i++ {
+		next := make(map[int]float64)
+		for roll, chance := range chances {
+			for j, face := range faces {
+				next[roll+j+1] += chance * face
+			}
+		}
+		chances = next
+	}
+
+	return chances
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseDice(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Dice
+		err  bool
+	}{
+		{spec: "d6", want: fairDice{Faces: 6}},
+		{spec: " D8 ", want: fairDice{Faces: 8}},
+		{spec: "d2", want: fairDice{Faces: 2}},
+		{spec: "d100", want: fairDice{Faces: 100}},
+		{spec: "weighted=1,1,2", want: weightedDice{Weights: []float64{1, 1, 2}}},
+		{spec: "weighted=0, 1.5", want: weightedDice{Weights: []float64{0, 1.5}}},
+		{spec: "d1", err: true},
+		{spec: "d101", err: true},
+		{spec: "d", err: true},
+		{spec: "6", err: true},
+		{spec: "weighted=1", err: true},
+		{spec: "weighted=0,0", err: true},
+		{spec: "weighted=1,-1", err: true},
+		{spec: "weighted=1,x", err: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseDice(test.spec)
+		if test.err {
+			if err == nil {
+				t.Errorf("parseDice(%q) = %v, want an error", test.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseDice(%q) returned error: %s", test.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseDice(%q) = %#v, want %#v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestRollChances(t *testing.T) {
+	saved := gameDice
+	defer func() { gameDice = saved }()
+
+	tests := []struct {
+		dice     Dice
+		dieCount int
+		want     map[int]float64
+	}{
+		{dice: fairDice{Faces: 6}, dieCount: 1, want: map[int]float64{1: 1.0 / 6, 3: 1.0 / 6, 6: 1.0 / 6, 7: 0}},
+		{dice: fairDice{Faces: 6}, dieCount: 2, want: map[int]float64{1: 0, 2: 1.0 / 36, 7: 6.0 / 36, 12: 1.0 / 36, 13: 0}},
+		{dice: fairDice{Faces: 8}, dieCount: 2, want: map[int]float64{9: 8.0 / 64, 16: 1.0 / 64}},
+		{dice: fairDice{Faces: 4}, dieCount: 2, want: map[int]float64{5: 4.0 / 16, 8: 1.0 / 16, 9: 0}},
+		{dice: weightedDice{Weights: []float64{1, 3}}, dieCount: 1, want: map[int]float64{1: 0.25, 2: 0.75}},
+		{dice: weightedDice{Weights: []float64{1, 3}}, dieCount: 2, want: map[int]float64{2: 1.0 / 16, 3: 6.0 / 16, 4: 9.0 / 16}},
+	}
+
+	for _, test := range tests {
+		gameDice = test.dice
+		chances := rollChances(test.dieCount)
+
+		total := 0.0
+		for _, chance := range chances {
+			total += chance
+		}
+		if math.Abs(total-1) > 1e-9 {
+			t.Errorf("The chances of %d dice %v add up to %f", test.dieCount, test.dice, total)
+		}
+		for roll, want := range test.want {
+			if got := chances[roll]; math.Abs(got-want) > 1e-9 {
+				t.Errorf("The chance of %d with %d dice %v is %f, want %f", roll, test.dieCount, test.dice, got, want)
+			}
+		}
+	}
+}
+
+func TestSumRoll(t *testing.T) {
+	tests := []struct {
+		dice    []int
+		roll    int
+		doubles bool
+	}{
+		{dice: []int{4}, roll: 4},
+		{dice: []int{3, 4}, roll: 7},
+		{dice: []int{3, 3}, roll: 6, doubles: true},
+		{dice: []int{1, 1}, roll: 2, doubles: true},
+		{dice: []int{8, 8}, roll: 16, doubles: true},
+		{dice: []int{2, 2, 2}, roll: 6},
+	}
+
+	for _, test := range tests {
+		roll, doubles := sumRoll(test.dice)
+		if roll != test.roll || doubles != test.doubles {
+			t.Errorf("sumRoll(%v) = %d, %t, want %d, %t", test.dice, roll, doubles, test.roll, test.doubles)
+		}
+	}
+}
+
+func TestScriptedDice(t *testing.T) {
+	tests := []struct {
+		name   string
+		rolls  [][]int
+		counts []int
+		want   [][]int
+		// fails is the roll that fails, or -1.
+		fails int
+	}{
+		{
+			name:   "in order",
+			rolls:  [][]int{{1, 2}, {5}, {6, 6}},
+			counts: []int{2, 1, 2},
+			want:   [][]int{{1, 2}, {5}, {6, 6}},
+			fails:  -1,
+		},
+		{
+			name:   "more rolls than given",
+			rolls:  [][]int{{3}},
+			counts: []int{1, 1},
+			want:   [][]int{{3}},
+			fails:  1,
+		},
+		{
+			name:   "other number of dice",
+			rolls:  [][]int{{3}, {2, 5}},
+			counts: []int{1, 1},
+			want:   [][]int{{3}},
+			fails:  1,
+		},
+	}
+
+	for _, test := range tests {
+		dice := &scriptedDice{Faces: 6, rolls: test.rolls}
+		for i, count := range test.counts {
+			got, err := dice.next(count)
+			if i == test.fails {
+				if err == nil {
+					t.Errorf("%s: roll %d = %v, want an error", test.name, i+1, got)
+				}
+				break
+			}
+			if err != nil {
+				t.Errorf("%s: roll %d returned error: %s", test.name, i+1, err)
+				break
+			}
+			if !reflect.DeepEqual(got, test.want[i]) {
+				t.Errorf("%s: roll %d = %v, want %v", test.name, i+1, got, test.want[i])
+			}
+		}
+	}
+}
+
+func TestScriptedDiceRollPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Roll past the end of the script did not panic")
+		}
+	}()
+
+	dice := &scriptedDice{Faces: 6}
+	dice.Roll(1)
+}
+
+func TestSeededDice(t *testing.T) {
+	for _, d := range []Dice{fairDice{Faces: 8}, weightedDice{Weights: []float64{1, 0, 2}}} {
+		first := seededDice(d, 42).Roll(200)
+		second := seededDice(d, 42).Roll(200)
+		if !reflect.DeepEqual(first, second) {
+			t.Errorf("Dice %v with the same seed rolled differently", d)
+		}
+
+		faces := diceFaces(d)
+		chances := d.Chances()
+		for _, face := range first {
+			if face < 1 || face > faces {
+				t.Fatalf("Dice %v rolled %d", d, face)
+			}
+			if chances[face-1] == 0 {
+				t.Fatalf("Dice %v rolled %d, which has no chance", d, face)
+			}
+		}
+	}
+}
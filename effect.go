@@ -8,26 +8,31 @@ type effect struct {
 	Priority    int
 	Description func() string
 	Call        func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int)
-}
+	// SpecialRoll is set when the effect pays out by the special roll of the
+	// turn.
+	SpecialRoll bool
 
-type prereq struct {
-	Desc string
-	Call func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool
+	// References lists what the effect depends on, so that the card data can
+	// be checked without playing the game (see lint-cards).
+	References effectReferences
 }
 
-var nullPrereq = prereq{
-	Desc: "",
-
-	Call: func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
-		return true
-	},
+// effectReferences are the cards, landmarks and icons an effect looks up by
+// name, and the amounts that should appear in its description.
+type effectReferences struct {
+	Cards     []string
+	Landmarks []string
+	Icons     []cardIcon
+	Amounts   []int
 }
 
-func landmarkCardAgumentedPayout(payout int, card supplyCard, p *player) int {
-	if p.LandmarkCards["Shopping Mall"] && (card.Icon == "Cup" || card.Icon == "Bread") {
-		return payout + 1
+func (r effectReferences) merge(o effectReferences) effectReferences {
+	return effectReferences{
+		Cards:     append(append([]string{}, r.Cards...), o.Cards...),
+		Landmarks: append(append([]string{}, r.Landmarks...), o.Landmarks...),
+		Icons:     append(append([]cardIcon{}, r.Icons...), o.Icons...),
+		Amounts:   append(append([]int{}, r.Amounts...), o.Amounts...),
 	}
-	return payout
 }
 
 func newBankPayoutWithPrereq(payout int, onlyCurrent bool, fromBank bool, pr prereq) effect {
@@ -47,7 +52,8 @@ func newBankPayoutWithPrereq(payout int, onlyCurrent bool, fromBank bool, pr pre
 	}
 
 	return effect{
-		Priority: 1,
+		Priority:   1,
+		References: pr.References.merge(effectReferences{Amounts: []int{payout}}),
 
 		Description: func() string {
 			if fromBank {
@@ -67,11 +73,11 @@ func newBankPayoutWithPrereq(payout int, onlyCurrent bool, fromBank bool, pr pre
 
 			totalPayout := landmarkCardAgumentedPayout(payout, card, p) * c
 
-			fmt.Printf("Player %d gets %d coins from the bank [%s].\n", p.ID, totalPayout, card.Name)
+			fmt.Fprintf(output, "Player %d gets %d coins from the bank [%s].\n", p.ID, totalPayout, card.Name)
 			remainder := bank.TransferTo(totalPayout, &p.Coins)
 
 			if remainder > 0 {
-				fmt.Printf("Bank did not have enough money. Missing: %d\n", remainder)
+				fmt.Fprintf(output, "Bank did not have enough money. Missing: %d\n", remainder)
 			}
 		},
 	}
@@ -107,7 +113,8 @@ func newRollerPayoutWithPrereq(payout int, pr prereq) effect {
 	}
 
 	return effect{
-		Priority: 0,
+		Priority:   0,
+		References: pr.References.merge(effectReferences{Amounts: []int{payout}}),
 
 		Description: func() string {
 			desc := pr.Desc + fmt.Sprintf("Get %s from the player who rolled the dice", coins)
@@ -124,72 +131,104 @@ func newRollerPayoutWithPrereq(payout int, pr prereq) effect {
 
 			totalPayout := landmarkCardAgumentedPayout(payout, card, p) * c
 
-			fmt.Printf("Player %d gets %d coins from the player %d [%s].\n", p.ID, totalPayout, rlr.ID, card.Name)
+			fmt.Fprintf(output, "Player %d gets %d coins from the player %d [%s].\n", p.ID, totalPayout, rlr.ID, card.Name)
 			remainder := rlr.Coins.TransferTo(totalPayout, &p.Coins)
 
 			if remainder > 0 {
-				fmt.Printf("Roller did not have enough money. Missing: %d\n", remainder)
+				fmt.Fprintf(output, "Roller did not have enough money. Missing: %d\n", remainder)
 			}
 		},
 	}
 }
 
-func newLandmarkPrereq(name string, forRoller bool) prereq {
-	return prereq{
-		Desc: fmt.Sprintf("If you have the [%s] landmark. ", name),
-		Call: func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
-			if forRoller {
-				return rlr.LandmarkCards[name]
+func newRollerPayout(payout int) effect {
+	return newRollerPayoutWithPrereq(payout, nullPrereq)
+}
+
+func newIconCardPayout(payout int, icon cardIcon) effect {
+	return effect{
+		Priority:   1,
+		References: effectReferences{Icons: []cardIcon{icon}, Amounts: []int{payout}},
+
+		Description: func() string {
+			return fmt.Sprintf("Get %d coins from the bank for each [%s] establishment that you own on your turn only", payout, icon)
+		},
+
+		Call: func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) {
+			if p != rlr {
+				return
+			}
+
+			totalPayout := landmarkCardAgumentedPayout(payout, card, p) * iconCardCount(p, icon) * c
+
+			fmt.Fprintf(output, "Player %d gets %d coins from the bank [%s].\n", p.ID, totalPayout, card.Name)
+			remainder := bank.TransferTo(totalPayout, &rlr.Coins)
+
+			if remainder > 0 {
+				fmt.Fprintf(output, "Bank did not have enough money. Missing: %d\n", remainder)
 			}
-			return p.LandmarkCards[name]
 		},
 	}
 }
 
-func newLandmarkMaxPrereq(max int) prereq {
-	return prereq{
-		Desc: fmt.Sprintf("If player has the less than %d constructed landmarks (excluding City Hall). ", max+1),
-		Call: func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
-			return landmarkCount(rlr) < max
+func newCardPayout(payout int, cardName string) effect {
+	return effect{
+		Priority:   1,
+		References: effectReferences{Cards: []string{cardName}, Amounts: []int{payout}},
+
+		Description: func() string {
+			return fmt.Sprintf("Get %d coins from the bank for each [%s] establishment that you own on your turn only", payout, cardName)
+		},
+
+		Call: func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) {
+			if p != rlr {
+				return
+			}
+
+			var cardCount int
+			if cardpc, ok := p.SupplyCards[cardName]; ok {
+				cardCount = cardpc.Total
+			}
+			totalPayout := landmarkCardAgumentedPayout(payout, card, p) * cardCount * c
+
+			fmt.Fprintf(output, "Player %d gets %d coins from the bank [%s].\n", p.ID, totalPayout, card.Name)
+			remainder := bank.TransferTo(totalPayout, &rlr.Coins)
+
+			if remainder > 0 {
+				fmt.Fprintf(output, "Bank did not have enough money. Missing: %d\n", remainder)
+			}
 		},
 	}
 }
 
-func landmarkCount(p *player) int {
-	var count int
-
-	for name, active := range p.LandmarkCards {
-		if name == "City Hall" {
-			continue
-		}
+func counterClockwise(all []*player, rlr *player) []*player {
+	var reversed []*player
+	index := rlr.ID
 
-		if active {
-			count++
-		}
+	for i := 0; i < len(all); i++ {
+		reversed = append(reversed, all[(len(all)+index-i)%len(all)])
 	}
 
-	return count
+	return reversed
 }
 
-func newLandmarkMinPrereq(min int) prereq {
-	return prereq{
-		Desc: fmt.Sprintf("If player has the more than %d constructed landmarks (excluding City Hall). ", min+1),
-		Call: func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
-			return landmarkCount(rlr) > min
-		},
+func closedCardCount(p *player) int {
+	var count int
+
+	for _, pc := range p.SupplyCards {
+		count += pc.Renovation
 	}
-}
 
-func newRollerPayout(payout int) effect {
-	return newRollerPayoutWithPrereq(payout, nullPrereq)
+	return count
 }
 
-func newIconCardPayout(payout int, icon string) effect {
+func newClosedCardPayout(payout int) effect {
 	return effect{
-		Priority: 1,
+		Priority:   1,
+		References: effectReferences{Amounts: []int{payout}},
 
 		Description: func() string {
-			return fmt.Sprintf("Get %d coins from the bank for each [%s] establishment that you own on your turn only", payout, icon)
+			return fmt.Sprintf("Get %d coins from the bank for each of your establishments closed for renovation on your turn only", payout)
 		},
 
 		Call: func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) {
@@ -197,29 +236,27 @@ func newIconCardPayout(payout int, icon string) effect {
 				return
 			}
 
-			iconCards := market.FindByIcon(icon)
-			iconCardCount := 0
-			for _, iconCard := range iconCards {
-				iconCardCount += p.SupplyCards[iconCard.Name].Total
-			}
-			totalPayout := landmarkCardAgumentedPayout(payout, card, p) * iconCardCount * c
+			totalPayout := payout * closedCardCount(p) * c
 
-			fmt.Printf("Player %d gets %d coins from the bank [%s].\n", p.ID, totalPayout, card.Name)
-			remainder := bank.TransferTo(totalPayout, &rlr.Coins)
+			fmt.Fprintf(output, "Player %d gets %d coins from the bank [%s].\n", p.ID, totalPayout, card.Name)
+			remainder := bank.TransferTo(totalPayout, &p.Coins)
 
 			if remainder > 0 {
-				fmt.Printf("Bank did not have enough money. Missing: %d\n", remainder)
+				fmt.Fprintf(output, "Bank did not have enough money. Missing: %d\n", remainder)
 			}
 		},
 	}
 }
 
-func newCardPayout(payout int, cardName string) effect {
+// newReopenEffect is a card with a negative effect on its owner, who has to
+// pay to reopen their establishments.
+func newReopenEffect(cost int) effect {
 	return effect{
-		Priority: 1,
+		Priority:   1,
+		References: effectReferences{Amounts: []int{cost}},
 
 		Description: func() string {
-			return fmt.Sprintf("Get %d coins from the bank for each [%s] establishment that you own on your turn only", payout, cardName)
+			return fmt.Sprintf("Reopen all of your establishments closed for renovation and pay %d coins to the bank for each, on your turn only", cost)
 		},
 
 		Call: func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) {
@@ -227,26 +264,90 @@ func newCardPayout(payout int, cardName string) effect {
 				return
 			}
 
-			cardCount := p.SupplyCards[cardName].Total
-			totalPayout := landmarkCardAgumentedPayout(payout, card, p) * cardCount * c
+			reopened := 0
+			for _, currentCard := range market.Cards {
+				playerCard, ok := p.SupplyCards[currentCard.Name]
+				if !ok {
+					continue
+				}
+				reopened += playerCard.Reopen()
+			}
+			if reopened == 0 {
+				return
+			}
 
-			fmt.Printf("Player %d gets %d coins from the bank [%s].\n", p.ID, totalPayout, card.Name)
-			remainder := bank.TransferTo(totalPayout, &rlr.Coins)
+			totalPayment := cost * reopened
+
+			fmt.Fprintf(output, "Player %d reopens %d establishments and pays %d coins to the bank [%s].\n", p.ID, reopened, totalPayment, card.Name)
+			remainder := p.Coins.TransferTo(totalPayment, &bank)
 
 			if remainder > 0 {
-				fmt.Printf("Bank did not have enough money. Missing: %d\n", remainder)
+				fmt.Fprintf(output, "Player %d did not have enough money. Missing: %d\n", p.ID, remainder)
 			}
 		},
 	}
 }
 
-func counterClockwise(all []*player, rlr *player) []*player {
-	var reversed []*player
-	index := rlr.ID
+func newSelfRenovationPayout(payout int) effect {
+	return effect{
+		Priority:   1,
+		References: effectReferences{Amounts: []int{payout}},
 
-	for i := 0; i < len(all); i++ {
-		reversed = append(reversed, all[(len(all)+index-i)%len(all)])
-	}
+		Description: func() string {
+			return fmt.Sprintf("You must close one of your non-[Major] establishments for renovation. When you do, get %d coins from the bank, on your turn only", payout)
+		},
 
-	return reversed
+		Call: func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) {
+			if p != rlr {
+				return
+			}
+
+			for i := 0; i < c; i++ {
+				var cardChoices []int
+				var cardChoiceNames []string
+
+				j := 1
+				for _, currentCard := range market.Cards {
+					playerCard, ok := p.SupplyCards[currentCard.Name]
+					if currentCard.Icon == majorIcon || !ok || playerCard.Active() == 0 {
+						continue
+					}
+
+					cardChoices = append(cardChoices, j)
+					cardChoiceNames = append(cardChoiceNames, currentCard.Name)
+					printMenu("  (%d) %s [%s]", j, currentCard.Name, playerCard)
+					j++
+				}
+
+				if len(cardChoices) == 0 {
+					fmt.Fprintln(output, "There are no open buildings to close for renovation.")
+					return
+				}
+
+				var cardIdx int
+				var err error
+
+				for {
+					fmt.Fprint(output, "Pick one of your cards to close for renovation: ")
+					cardIdx, err = promptChoice(cardChoices, cardChoiceNames)
+					if err != nil {
+						fmt.Fprintln(output, err)
+						continue
+					}
+					break
+				}
+				cardName := cardChoiceNames[cardIdx-1]
+
+				p.SupplyCards[cardName].Close(1)
+				fmt.Fprintf(output, "Player %d closes %s for renovations [%s]\n", p.ID, cardName, card.Name)
+
+				fmt.Fprintf(output, "Player %d gets %d coins from the bank [%s]\n", p.ID, payout, card.Name)
+				remainder := bank.TransferTo(payout, &p.Coins)
+
+				if remainder > 0 {
+					fmt.Fprintf(output, "Bank did not have enough money. Missing: %d\n", remainder)
+				}
+			}
+		},
+	}
 }
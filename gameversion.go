@@ -1,6 +1,283 @@
 package main
 
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
 type gameVersion struct {
 	Name string
-	Init func()
+	Init func() error
+	// HasWon checks if the player won the game. When it is not set, a player
+	// wins by building all landmarks.
+	HasWon func(p *player) bool
+	// FreeDieChoice lets players roll 1 or 2 dice without a Train Station.
+	FreeDieChoice bool
+}
+
+func (v gameVersion) Won(p *player) bool {
+	if builtWinningLandmark(p) {
+		return true
+	}
+	if v.HasWon == nil {
+		return allLandmarksBuilt(p)
+	}
+
+	return v.HasWon(p)
+}
+
+// allLandmarksBuilt is the classic win condition. Landmarks that win the game
+// on their own, like the Launch Pad, are an alternative and not required, and
+// neither are optional landmarks like the Loan Office.
+func allLandmarksBuilt(p *player) bool {
+	for name, hasLandmark := range p.LandmarkCards {
+		if landmark, ok := market.FindLandmark(name); ok && (landmark.WinsGame || landmark.Optional) {
+			continue
+		}
+		if !hasLandmark {
+			return false
+		}
+	}
+
+	return true
+}
+
+func builtWinningLandmark(p *player) bool {
+	for _, landmark := range market.LandmarkCards {
+		if landmark.WinsGame && p.LandmarkCards[landmark.Name] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// machiKoro2Won is the Machi Koro 2 win condition, 3 built landmarks.
+func machiKoro2Won(p *player) bool {
+	return landmarkCount(p) >= 3
+}
+
+// cardSet is a group of establishments that are sold together, for example
+// the cards of one expansion.
+type cardSet struct {
+	Name  string
+	Cards []*supplyCard
+}
+
+// versionConfig describes a game version built from card sets and landmarks.
+// It is saved as JSON so that custom versions can be reused as presets.
+type versionConfig struct {
+	Name          string   `json:"name"`
+	CardSets      []string `json:"card_sets"`
+	Landmarks     []string `json:"landmarks"`
+	Market        string   `json:"market"`
+	StartingCoins int      `json:"starting_coins"`
+	StartingCards []string `json:"starting_cards"`
+}
+
+const (
+	basicMarketLayout     = "basic"
+	expansionMarketLayout = "expansion"
+
+	versionPresetsFile = "versions.json"
+)
+
+func findCardSet(name string) (cardSet, bool) {
+	for _, set := range cardSetsSorted {
+		if set.Name == name {
+			return set, true
+		}
+	}
+
+	return cardSet{}, false
+}
+
+func findLandmark(name string) (landmarkCard, bool) {
+	for _, landmark := range allLandmarkCards {
+		if landmark.Name == name {
+			return landmark, true
+		}
+	}
+
+	return landmarkCard{}, false
+}
+
+// Validate checks that everything the config references exists, so a broken
+// preset is reported when it is loaded and not in the middle of a game.
+func (v versionConfig) Validate() error {
+	if v.Name == "" {
+		return fmt.Errorf("Version has no name")
+	}
+	for _, version := range builtInGameVersions {
+		if strings.EqualFold(version.Name, v.Name) {
+			return fmt.Errorf("Version %s has the name of a built-in version, choose another name", v.Name)
+		}
+	}
+	if len(v.CardSets) == 0 {
+		return fmt.Errorf("Version %s has no card sets", v.Name)
+	}
+
+	var cards []*supplyCard
+	for i, name := range v.CardSets {
+		set, ok := findCardSet(name)
+		if !ok {
+			return fmt.Errorf("Version %s has unknown card set '%s'", v.Name, name)
+		}
+		for _, other := range v.CardSets[:i] {
+			if other == name {
+				return fmt.Errorf("Version %s has card set '%s' more than once", v.Name, name)
+			}
+		}
+		cards = append(cards, set.Cards...)
+	}
+
+	buyable := 0
+	for _, name := range v.Landmarks {
+		landmark, ok := findLandmark(name)
+		if !ok {
+			return fmt.Errorf("Version %s has unknown landmark '%s'", v.Name, name)
+		}
+		if landmark.Cost > 0 {
+			buyable++
+		}
+	}
+	// Without a landmark to build, the first player would win immediately.
+	if buyable == 0 {
+		return fmt.Errorf("Version %s has no landmarks to build", v.Name)
+	}
+
+	switch v.Market {
+	case basicMarketLayout, expansionMarketLayout:
+	default:
+		return fmt.Errorf("Version %s has unknown market layout '%s'", v.Name, v.Market)
+	}
+
+	if v.StartingCoins < 0 {
+		return fmt.Errorf("Version %s has negative starting coins", v.Name)
+	}
+
+	for _, name := range v.StartingCards {
+		if _, ok := findByName(cards, name); !ok {
+			return fmt.Errorf("Version %s starts with '%s', which is not in its card sets", v.Name, name)
+		}
+	}
+
+	return nil
+}
+
+func (v versionConfig) GameVersion() gameVersion {
+	return gameVersion{
+		Name: v.Name,
+		Init: func() error {
+			var cards []*supplyCard
+			for _, name := range v.CardSets {
+				set, _ := findCardSet(name)
+				cards = append(cards, set.Cards...)
+			}
+
+			var landmarks []landmarkCard
+			for _, name := range v.Landmarks {
+				landmark, _ := findLandmark(name)
+				landmarks = append(landmarks, landmark)
+			}
+
+			var err error
+			if v.Market == expansionMarketLayout {
+				market, err = newExpansionMarketplace(cards, landmarks)
+			} else {
+				market, err = newBasicMarketplace(cards, landmarks)
+			}
+
+			startingCoins = v.StartingCoins
+			startingSupplyCards = v.StartingCards
+
+			return err
+		},
+	}
+}
+
+func versionPresetsPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, versionPresetsFile), nil
+}
+
+// loadVersionPresets reads the saved custom versions. A missing presets file
+// is not an error, there just aren't any presets yet. Presets that are not
+// valid are left out, so that they can't replace a version, and the first
+// problem is returned.
+func loadVersionPresets() ([]versionConfig, error) {
+	var presets []versionConfig
+
+	path, err := versionPresetsPath()
+	if err != nil {
+		return presets, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return presets, nil
+	}
+	if err != nil {
+		return presets, err
+	}
+
+	if err = json.Unmarshal(data, &presets); err != nil {
+		return presets, fmt.Errorf("Could not read version presets from %s: %v", path, err)
+	}
+
+	var valid []versionConfig
+	var problem error
+	for _, preset := range presets {
+		if err = preset.Validate(); err != nil {
+			if problem == nil {
+				problem = err
+			}
+			continue
+		}
+		valid = append(valid, preset)
+	}
+
+	return valid, problem
+}
+
+// saveVersionPreset stores the config, replacing a preset with the same name.
+func saveVersionPreset(config versionConfig) error {
+	presets, err := loadVersionPresets()
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i, preset := range presets {
+		if preset.Name == config.Name {
+			presets[i] = config
+			replaced = true
+		}
+	}
+	if !replaced {
+		presets = append(presets, config)
+	}
+
+	data, err := json.MarshalIndent(presets, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path, err := versionPresetsPath()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
 }
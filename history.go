@@ -0,0 +1,535 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Players can have profiles, which are names for the seats of a game given
+// with --names. Every game that is played to the end is added to the match
+// history with its seats, version, standings and number of turns, and with
+// the seed and the answers of the game, so that it can be replayed.
+
+const (
+	profilesFile = "profiles.json"
+	historyFile  = "history.jsonl"
+)
+
+type profile struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+type matchRecord struct {
+	// ID is the position of the match in the history. It is counted when the
+	// history is read, so that games that several processes finish at the
+	// same time get different IDs.
+	ID        int             `json:"-"`
+	Finished  time.Time       `json:"finished"`
+	Version   string          `json:"version"`
+	Mode      string          `json:"mode,omitempty"`
+	Seats     []matchSeat     `json:"seats"`
+	Standings []matchStanding `json:"standings"`
+	Turns     int             `json:"turns"`
+
+	// The dice, the seed and the answers replay the game.
+	Dice     string   `json:"dice,omitempty"`
+	DiceSeed int64    `json:"dice_seed,omitempty"`
+	Seed     int64    `json:"seed"`
+	Answers  []string `json:"answers"`
+}
+
+// matchSeat is a player of a match, with their profile or their bot.
+type matchSeat struct {
+	Seat int    `json:"seat"`
+	Name string `json:"name,omitempty"`
+	Bot  string `json:"bot,omitempty"`
+}
+
+// matchStanding is the place of a player at the end of the match, the winner
+// first and the others by their landmarks and then by their coins.
+type matchStanding struct {
+	Place     int `json:"place"`
+	Seat      int `json:"seat"`
+	Landmarks int `json:"landmarks"`
+	Coins     int `json:"coins"`
+}
+
+// matchSetup is how the match is set up by the flags of the game.
+type matchSetup struct {
+	Names    []string
+	Bots     botFlags
+	Dice     string
+	DiceSeed int64
+}
+
+func dataPath(file string) (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, file), nil
+}
+
+// loadProfiles reads the profiles. A missing profiles file is not an error,
+// there just aren't any profiles yet.
+func loadProfiles() ([]profile, error) {
+	var profiles []profile
+
+	path, err := dataPath(profilesFile)
+	if err != nil {
+		return profiles, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return profiles, nil
+	}
+	if err != nil {
+		return profiles, err
+	}
+
+	if err = json.Unmarshal(data, &profiles); err != nil {
+		return profiles, fmt.Errorf("Could not read the profiles from %s: %v", path, err)
+	}
+
+	return profiles, nil
+}
+
+// addProfiles adds the profiles with the names that don't have one yet.
+func addProfiles(names []string) error {
+	profiles, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+
+	added := false
+	for _, name := range names {
+		if name == "" || findProfile(profiles, name) != -1 {
+			continue
+		}
+		profiles = append(profiles, profile{Name: name, Created: time.Now().UTC()})
+		added = true
+	}
+	if !added {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path, err := dataPath(profilesFile)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func findProfile(profiles []profile, name string) int {
+	for i, p := range profiles {
+		if strings.EqualFold(p.Name, name) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// parseNames reads the names of the seats, like alice,bob. An empty name
+// leaves the seat without a profile.
+func parseNames(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		names = append(names, strings.TrimSpace(name))
+	}
+
+	return names
+}
+
+func loadHistory() ([]matchRecord, error) {
+	var records []matchRecord
+
+	path, err := dataPath(historyFile)
+	if err != nil {
+		return records, err
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return records, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var record matchRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return records, fmt.Errorf("Could not read line %d of the history in %s: %v", line, path, err)
+		}
+		record.ID = len(records) + 1
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+// appendMatch adds the match to the history, and returns it with its ID.
+func appendMatch(record matchRecord) (matchRecord, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return record, err
+	}
+
+	path, err := dataPath(historyFile)
+	if err != nil {
+		return record, err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return record, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return record, err
+	}
+	// The line is written at once, so that the lines of other processes
+	// don't end up in the middle of it.
+	_, err = file.Write(append(data, '\n'))
+	file.Close()
+	if err != nil {
+		return record, err
+	}
+
+	records, err := loadHistory()
+	if err != nil {
+		return record, err
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Seed == record.Seed && records[i].Finished.Equal(record.Finished) {
+			record.ID = records[i].ID
+			break
+		}
+	}
+
+	return record, nil
+}
+
+// playMatch plays a game and adds it to the match history when it is played
+// to the end. The mode is how the game is played, for the replay.
+func playMatch(mode string) error {
+	seed := time.Now().UnixNano()
+	rand.Seed(seed)
+
+	var answers []string
+	turns := 0
+	var lastTurn *turn
+	play := decide
+	decide = func(req decisionRequest) string {
+		if currentTurn != lastTurn {
+			lastTurn = currentTurn
+			turns++
+		}
+		line := play(req)
+		answers = append(answers, recordedAnswer(req, line))
+		return line
+	}
+	defer func() {
+		decide = play
+	}()
+
+	if err := playGame(); err != nil {
+		return err
+	}
+
+	record := matchRecord{
+		Finished:  time.Now().UTC(),
+		Version:   currentVersion.Name,
+		Mode:      mode,
+		Standings: standings(),
+		Turns:     turns,
+		Dice:      currentMatch.Dice,
+		DiceSeed:  currentMatch.DiceSeed,
+		Seed:      seed,
+		Answers:   answers,
+	}
+	for _, p := range plrs {
+		seat := matchSeat{Seat: p.ID}
+		if p.ID < len(currentMatch.Names) {
+			seat.Name = currentMatch.Names[p.ID]
+		}
+		for _, value := range currentMatch.Bots {
+			if botSeat, command, err := parseBotFlag(value); err == nil && botSeat == p.ID {
+				seat.Bot = command
+			}
+		}
+		record.Seats = append(record.Seats, seat)
+	}
+
+	err := addProfiles(currentMatch.Names)
+	if err == nil {
+		record, err = appendMatch(record)
+	}
+	if err != nil {
+		fmt.Fprintf(output, "Could not add the game to the match history: %s\n", err)
+	} else if mode != protocolMode {
+		fmt.Fprintf(output, "Added the game to the match history as game %d.\n", record.ID)
+	}
+
+	return nil
+}
+
+// protocolMode is the mode of the games played over the protocol, which are
+// added to the history without telling the players.
+const protocolMode = "protocol"
+
+// standings are the places of the players at the end of the game.
+func standings() []matchStanding {
+	winner := currentTurn.Roller.ID
+
+	var s []matchStanding
+	for _, p := range plrs {
+		landmarks := 0
+		for _, built := range p.LandmarkCards {
+			if built {
+				landmarks++
+			}
+		}
+		s = append(s, matchStanding{Seat: p.ID, Landmarks: landmarks, Coins: p.Coins.Total()})
+	}
+
+	sort.SliceStable(s, func(i, j int) bool {
+		if (s[i].Seat == winner) != (s[j].Seat == winner) {
+			return s[i].Seat == winner
+		}
+		if s[i].Landmarks != s[j].Landmarks {
+			return s[i].Landmarks > s[j].Landmarks
+		}
+		return s[i].Coins > s[j].Coins
+	})
+	for i := range s {
+		s[i].Place = i + 1
+	}
+
+	return s
+}
+
+// seatName is the name of the seat in the match, its profile, its bot or its
+// number.
+func (r matchRecord) seatName(seat int) string {
+	for _, s := range r.Seats {
+		if s.Seat != seat {
+			continue
+		}
+		if s.Name != "" {
+			return s.Name
+		}
+		if s.Bot != "" {
+			return "bot " + s.Bot
+		}
+	}
+
+	return fmt.Sprintf("Player %d", seat)
+}
+
+// hasPlayer reports whether the profile played in the match.
+func (r matchRecord) hasPlayer(name string) bool {
+	for _, s := range r.Seats {
+		if strings.EqualFold(s.Name, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r matchRecord) winner() int {
+	if len(r.Standings) == 0 {
+		return -1
+	}
+
+	return r.Standings[0].Seat
+}
+
+// runHistory lists the matches of the history, or replays one.
+func runHistory(args []string) error {
+	if len(args) > 0 && args[0] == "replay" {
+		if len(args) != 2 {
+			return errors.New("Use history replay <game>")
+		}
+		return replayMatch(args[1])
+	}
+
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	player := flags.String("player", "", "Only the games of the profile")
+	version := flags.String("version", "", "Only the games of the version")
+	winner := flags.String("winner", "", "Only the games the profile won")
+	limit := flags.Int("limit", 20, "The number of games to list, the latest first")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	records, err := loadHistory()
+	if err != nil {
+		return err
+	}
+
+	var listed []matchRecord
+	for i := len(records) - 1; i >= 0 && len(listed) < *limit; i-- {
+		r := records[i]
+		if *player != "" && !r.hasPlayer(*player) {
+			continue
+		}
+		if *version != "" && !strings.EqualFold(r.Version, *version) {
+			continue
+		}
+		if *winner != "" && !strings.EqualFold(r.seatName(r.winner()), *winner) {
+			continue
+		}
+		listed = append(listed, r)
+	}
+
+	if len(listed) == 0 {
+		fmt.Fprintln(output, "No games in the match history.")
+		return nil
+	}
+	for _, r := range listed {
+		var places []string
+		for _, s := range r.Standings {
+			places = append(places, fmt.Sprintf("%d. %s (%d landmarks, %d coins)", s.Place, r.seatName(s.Seat), s.Landmarks, s.Coins))
+		}
+		fmt.Fprintf(output, "Game %d, %s, %s, %d turns: %s\n", r.ID, r.Finished.Local().Format("2006-01-02 15:04"), r.Version, r.Turns, strings.Join(places, ", "))
+	}
+
+	return nil
+}
+
+// replayMatch plays the game of the history again with its seed and its
+// answers.
+func replayMatch(id string) error {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return fmt.Errorf("Invalid game '%s', use the number of the game", id)
+	}
+
+	records, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	var record *matchRecord
+	for i := range records {
+		if records[i].ID == n {
+			record = &records[i]
+		}
+	}
+	if record == nil {
+		return fmt.Errorf("There is no game %d in the match history", n)
+	}
+
+	restore := saveGlobals()
+	defer restore()
+
+	if record.Dice != "" {
+		if gameDice, err = parseDice(record.Dice); err != nil {
+			return err
+		}
+	}
+	if record.DiceSeed != 0 {
+		gameDice = seededDice(gameDice, record.DiceSeed)
+	}
+	if record.Mode == companionMode {
+		setUpCompanion()
+	}
+	rand.Seed(record.Seed)
+
+	answers := record.Answers
+	decide = func(req decisionRequest) string {
+		if len(answers) == 0 {
+			panic(gameQuit{})
+		}
+		answer := replayAnswer(req, answers[0])
+		answers = answers[1:]
+		fmt.Fprintln(output, answer)
+		return answer
+	}
+
+	fmt.Fprintf(output, "Replay of game %d, %s:\n", record.ID, record.Finished.Local().Format("2006-01-02 15:04"))
+	if err = playGame(); err == errGameQuit {
+		return errors.New("The replay ended before the game did, the game can't be replayed")
+	}
+
+	return err
+}
+
+// runProfiles lists the profiles with their games and wins, or adds one.
+func runProfiles(args []string) error {
+	if len(args) > 0 && args[0] == "add" {
+		if len(args) != 2 || strings.TrimSpace(args[1]) == "" {
+			return errors.New("Use profiles add <name>")
+		}
+		if err := addProfiles([]string{strings.TrimSpace(args[1])}); err != nil {
+			return err
+		}
+		fmt.Fprintf(output, "Added the profile %s.\n", strings.TrimSpace(args[1]))
+		return nil
+	}
+	if len(args) != 0 {
+		return errors.New("Use profiles, or profiles add <name>")
+	}
+
+	profiles, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+	records, err := loadHistory()
+	if err != nil {
+		return err
+	}
+
+	if len(profiles) == 0 {
+		fmt.Fprintln(output, "No profiles yet, add one with profiles add <name> or play with --names.")
+		return nil
+	}
+	for _, p := range profiles {
+		games, wins := 0, 0
+		for _, r := range records {
+			if !r.hasPlayer(p.Name) {
+				continue
+			}
+			games++
+			if strings.EqualFold(r.seatName(r.winner()), p.Name) {
+				wins++
+			}
+		}
+		fmt.Fprintf(output, "%s: %d games, %d wins\n", p.Name, games, wins)
+	}
+
+	return nil
+}
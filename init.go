@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"math/rand"
+	"os"
 	"time"
 )
 
@@ -17,10 +19,10 @@ var (
 
 	atLeastThreeLandmarks = newLandmarkMinPrereq(2)
 	membersOnlyClubEffect = effect{
-		Priority: 1,
+		Priority: 0,
 
 		Description: func() string {
-			return atLeastThreeLandmarks.Desc + "If the player who rolled the dice has 3 or more constructed landmarks, get all of their coins."
+			return atLeastThreeLandmarks.Desc + "Get all of the coins of the player who rolled the dice"
 		},
 
 		Call: func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) {
@@ -33,11 +35,11 @@ var (
 
 			totalPayout := rlr.Coins.Total()
 
-			fmt.Printf("Player %d gets %d coins from the player %d [%s].\n", p.ID, totalPayout, rlr.ID, card.Name)
-			remainder := bank.TransferTo(totalPayout, &p.Coins)
+			fmt.Fprintf(output, "Player %d gets %d coins from the player %d [%s].\n", p.ID, totalPayout, rlr.ID, card.Name)
+			remainder := rlr.Coins.TransferTo(totalPayout, &p.Coins)
 
 			if remainder > 0 {
-				fmt.Printf("Roller did not have enough money. Missing: %d\n", remainder)
+				fmt.Fprintf(output, "Roller did not have enough money. Missing: %d\n", remainder)
 			}
 		},
 	}
@@ -57,7 +59,7 @@ var (
 			var hoard coinSet
 
 			for _, plr := range plrs {
-				fmt.Printf("Player %d puts %d coins into the redistribution.\n", p.ID, plr.Coins.Total())
+				fmt.Fprintf(output, "Player %d puts %d coins into the redistribution.\n", p.ID, plr.Coins.Total())
 				plr.Coins.TransferTo(plr.Coins.Total(), &hoard)
 			}
 
@@ -65,7 +67,7 @@ var (
 			missing := hoard.Total() % len(plrs)
 			remainder := bank.TransferTo(missing, &hoard)
 			if remainder > 0 {
-				fmt.Printf("Bank did not have enough money to fill up the redistribution. Missing: %d\n", remainder)
+				fmt.Fprintf(output, "Bank did not have enough money to fill up the redistribution. Missing: %d\n", remainder)
 			}
 			// If there is missing coins, total payout is 1 short
 			if missing > 0 {
@@ -73,18 +75,19 @@ var (
 			}
 
 			for _, plr := range counterClockwise(plrs, rlr) {
-				fmt.Printf("Player %d gets %d coins from the redistribution [%s].\n", p.ID, totalPayout, card.Name)
+				fmt.Fprintf(output, "Player %d gets %d coins from the redistribution [%s].\n", p.ID, totalPayout, card.Name)
 				remainder = hoard.TransferTo(totalPayout, &plr.Coins)
 
 				if remainder > 0 {
-					fmt.Printf("Redistribution did not have enough money. Missing: %d\n", remainder)
+					fmt.Fprintf(output, "Redistribution did not have enough money. Missing: %d\n", remainder)
 				}
 			}
 		},
 	}
 
 	sodaBottlingPlantEffect = effect{
-		Priority: 1,
+		Priority:   1,
+		References: effectReferences{Icons: []cardIcon{cupIcon}, Amounts: []int{1}},
 
 		Description: func() string {
 			return "Get 1 coin from the bank for every [Cup] owned by all players, on your turn only"
@@ -95,22 +98,18 @@ var (
 				return
 			}
 
-			iconCardCount := 0
-			iconCards := market.FindByIcon("Cup")
-
+			cupCount := 0
 			for _, plr := range plrs {
-				for _, iconCard := range iconCards {
-					iconCardCount += plr.SupplyCards[iconCard.Name].Total
-				}
+				cupCount += iconCardCount(plr, cupIcon)
 			}
 
-			totalPayout := 1 * iconCardCount
+			totalPayout := 1 * cupCount * c
 
-			fmt.Printf("Player %d gets %d coins from the bank [%s].\n", p.ID, totalPayout, card.Name)
+			fmt.Fprintf(output, "Player %d gets %d coins from the bank [%s].\n", p.ID, totalPayout, card.Name)
 			remainder := bank.TransferTo(totalPayout, &p.Coins)
 
 			if remainder > 0 {
-				fmt.Printf("Bank did not have enough money. Missing: %d\n", remainder)
+				fmt.Fprintf(output, "Bank did not have enough money. Missing: %d\n", remainder)
 			}
 		},
 	}
@@ -135,11 +134,11 @@ var (
 					continue
 				}
 
-				fmt.Printf("Player %d gets %d coins from player %d [%s]\n", rlr.ID, totalPayout, plr.ID, card.Name)
+				fmt.Fprintf(output, "Player %d gets %d coins from player %d [%s]\n", rlr.ID, totalPayout, plr.ID, card.Name)
 				remainder := plr.Coins.TransferTo(totalPayout, &rlr.Coins)
 
 				if remainder > 0 {
-					fmt.Printf("Player %d did not have enough money. Missing: %d\n", plr.ID, remainder)
+					fmt.Fprintf(output, "Player %d did not have enough money. Missing: %d\n", plr.ID, remainder)
 				}
 			}
 		},
@@ -147,10 +146,11 @@ var (
 
 	wineryPayout = newCardPayout(6, "Vineyard")
 	wineryEffect = effect{
-		Priority: 1,
+		Priority:   1,
+		References: wineryPayout.References,
 
 		Description: func() string {
-			return "Get 6 coins for each vineyard you have, then close this building for renovation, on your turn only"
+			return "Get 6 coins for each [Vineyard] you have, then close this building for renovation, on your turn only"
 		},
 
 		Call: func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) {
@@ -160,14 +160,14 @@ var (
 
 			wineryPayout.Call(card, rlr, p, c, pc, specialRoll)
 
-			fmt.Printf("%d of Player %d's %s cards are closed for renovation.\n", c, p.ID, card.Name)
-
-			pc.Renovation = pc.Total
+			closed := pc.Close(c)
+			fmt.Fprintf(output, "%d of Player %d's %s cards are closed for renovation.\n", closed, p.ID, card.Name)
 		},
 	}
 
 	movingCompanyEffect = effect{
-		Priority: 1,
+		Priority:   1,
+		References: effectReferences{Amounts: []int{4}},
 
 		Description: func() string {
 			return "You must give a non-[Major] building you own to another player. When you do, get 4 coins from the bank, on your turn only"
@@ -180,27 +180,29 @@ var (
 
 			for i := 0; i < c; i++ {
 				plrChoices := []int{}
+				plrChoiceNames := []string{}
 				cardChoices := make(map[int][]int)
 				cardChoiceNames := make(map[int][]string)
 
 				for _, plr := range plrs {
 					if plr == rlr {
-						fmt.Printf("Roller has cards:\n")
+						printMenu("Roller has cards:")
 					} else {
 						plrChoices = append(plrChoices, plr.ID)
-						fmt.Printf("Player (%d) has cards:\n", plr.ID)
+						plrChoiceNames = append(plrChoiceNames, fmt.Sprintf("Player %d", plr.ID))
+						printMenu("Player (%d) has cards:", plr.ID)
 					}
 
 					j := 1
 					for cardName, playerCard := range plr.SupplyCards {
-						currentCard := market.FindByName(cardName)
+						currentCard, ok := market.FindByName(cardName)
 
-						if currentCard.Icon == "Major" || playerCard.Total == 0 {
+						if (ok && currentCard.Icon == majorIcon) || playerCard.Total == 0 {
 							continue
 						}
 						cardChoices[plr.ID] = append(cardChoices[plr.ID], j)
 						cardChoiceNames[plr.ID] = append(cardChoiceNames[plr.ID], cardName)
-						fmt.Printf("  (%d) %s [%d]\n", j, cardName, playerCard.Total)
+						printMenu("  (%d) %s [%s]", j, cardName, playerCard)
 						j++
 					}
 				}
@@ -210,47 +212,37 @@ var (
 				var err error
 
 				for {
-					fmt.Println("Pick a player to trade cards with: ")
-					plrID, err = scanInt(plrChoices)
+					fmt.Fprint(output, "Pick a player to trade cards with: ")
+					plrID, err = promptChoice(plrChoices, plrChoiceNames)
 					if err != nil {
-						fmt.Println(err)
+						fmt.Fprintln(output, err)
 						continue
 					}
 					break
 				}
 
 				for {
-					fmt.Println("Pick a card to give: ")
-					giveCardIdx, err = scanInt(cardChoices[rlr.ID])
+					fmt.Fprint(output, "Pick a card to give: ")
+					giveCardIdx, err = promptChoice(cardChoices[rlr.ID], cardChoiceNames[rlr.ID])
 					if err != nil {
-						fmt.Println(err)
+						fmt.Fprintln(output, err)
 						continue
 					}
 					break
 				}
 				giveCardName := cardChoiceNames[rlr.ID][giveCardIdx-1]
 
-				fmt.Printf("Player %d gives %s to player %d [%s]\n", rlr.ID, giveCardName, plrID, card.Name)
-				rlr.SupplyCards[giveCardName].Total--
-
-				for _, plr := range plrs {
-					if plr.ID != plrID {
-						continue
-					}
-
-					givepc, ok := p.SupplyCards[giveCardName]
-					if !ok {
-						givepc = &playerCard{}
-						p.SupplyCards[giveCardName] = givepc
-					}
-					givepc.Total++
+				fmt.Fprintf(output, "Player %d gives %s to player %d [%s]\n", rlr.ID, giveCardName, plrID, card.Name)
+				if err = rlr.GiveCard(giveCardName, plrs[plrID]); err != nil {
+					fmt.Fprintln(output, err)
+					continue
 				}
 
-				fmt.Printf("Player %d gets 4 coins from the bank [%s]\n", rlr.ID, card.Name)
+				fmt.Fprintf(output, "Player %d gets 4 coins from the bank [%s]\n", rlr.ID, card.Name)
 				remainder := bank.TransferTo(4, &rlr.Coins)
 
 				if remainder > 0 {
-					fmt.Printf("Bank did not have enough money. Missing: %d\n", remainder)
+					fmt.Fprintf(output, "Bank did not have enough money. Missing: %d\n", remainder)
 				}
 			}
 		},
@@ -269,62 +261,73 @@ var (
 			}
 
 			for i := 0; i < c; i++ {
-				plrChoices := []int{}
-				cardChoicesCount := make(map[string]int)
+				var cardChoices []int
+				var cardChoiceNames []string
 
-				for _, plr := range plrs {
-					if plr == rlr {
-						fmt.Printf("Roller has cards:\n")
-					} else {
-						plrChoices = append(plrChoices, plr.ID)
-						fmt.Printf("Player (%d) has cards:\n", plr.ID)
+				j := 1
+				for _, currentCard := range market.Cards {
+					if currentCard.Icon == majorIcon {
+						continue
 					}
 
-					j := 1
-					for cardName, playerCard := range plr.SupplyCards {
-						currentCard := market.FindByName(cardName)
-
-						if currentCard.Icon == "Major" || playerCard.Total == 0 {
-							continue
+					var open int
+					var closed int
+					for _, plr := range plrs {
+						if playerCard, ok := plr.SupplyCards[currentCard.Name]; ok {
+							open += playerCard.Active()
+							closed += playerCard.Renovation
 						}
-						cardChoicesCount[cardName]++
-						j++
 					}
+					if open == 0 {
+						continue
+					}
+
+					cardChoices = append(cardChoices, j)
+					cardChoiceNames = append(cardChoiceNames, currentCard.Name)
+					printMenu("  (%d) %s [%d open, %d closed]", j, currentCard.Name, open, closed)
+					j++
+				}
+
+				if len(cardChoices) == 0 {
+					fmt.Fprintln(output, "There are no open buildings to close for renovation.")
+					return
 				}
 
 				var cardIdx int
-				var cardChoices []int
-				var cardChoiceNames []string
 				var err error
-				var i int
 
-				for cardName, count := range cardChoicesCount {
-					cardChoices = append(cardChoices, i)
-					cardChoiceNames = append(cardChoiceNames, cardName)
-					fmt.Printf("  (%d) %s [%d]\n", i, cardName, count)
-					i++
-				}
-				fmt.Println("Pick a card to close for renovation: ")
-				cardIdx, err = scanInt(cardChoices)
-				if err != nil {
-					fmt.Println(err)
-					continue
+				for {
+					fmt.Fprint(output, "Pick a card to close for renovation: ")
+					cardIdx, err = promptChoice(cardChoices, cardChoiceNames)
+					if err != nil {
+						fmt.Fprintln(output, err)
+						continue
+					}
+					break
 				}
 				cardName := cardChoiceNames[cardIdx-1]
 
-				fmt.Printf("Player %d closes %s for renovations [%s]\n", rlr.ID, cardName, card.Name)
+				fmt.Fprintf(output, "Player %d closes %s for renovations [%s]\n", rlr.ID, cardName, card.Name)
 
+				totalPayment := 0
 				for _, plr := range plrs {
-					plr.SupplyCards[cardName].Renovation = plr.SupplyCards[cardName].Total
-				}
+					playerCard, ok := plr.SupplyCards[cardName]
+					if !ok {
+						continue
+					}
 
-				totalPayment := cardChoicesCount[cardName]
+					closed := playerCard.Close(playerCard.Active())
+					if closed > 0 {
+						fmt.Fprintf(output, "%d of Player %d's %s cards are closed for renovation.\n", closed, plr.ID, cardName)
+					}
+					totalPayment += closed
+				}
 
-				fmt.Printf("Player %d gets %d coins from the bank [%s]\n", rlr.ID, totalPayment, card.Name)
+				fmt.Fprintf(output, "Player %d gets %d coins from the bank [%s]\n", rlr.ID, totalPayment, card.Name)
 				remainder := bank.TransferTo(totalPayment, &rlr.Coins)
 
 				if remainder > 0 {
-					fmt.Printf("Bank did not have enough money. Missing: %d\n", remainder)
+					fmt.Fprintf(output, "Bank did not have enough money. Missing: %d\n", remainder)
 				}
 			}
 		},
@@ -332,7 +335,8 @@ var (
 
 	atLeastOneLandmarkPrereq = newLandmarkMinPrereq(0)
 	demolitionCompanyEffect  = effect{
-		Priority: 1,
+		Priority:   1,
+		References: effectReferences{Amounts: []int{8}},
 
 		Description: func() string {
 			return "For each Demolition Company you own, you must demolish a constructed landmark and take 8 coins from the bank, on your turn only"
@@ -350,8 +354,8 @@ var (
 				j := 0
 				choices := []int{}
 				choiceNames := []string{}
-				fmt.Printf("Player %d Landmarks: \n", rlr.ID)
-				for _, landmark := range landmarkCardsSorted {
+				printMenu("Player %d Landmarks:", rlr.ID)
+				for _, landmark := range market.LandmarkCards {
 					if !rlr.LandmarkCards[landmark.Name] || landmark.Name == "City Hall" {
 						continue
 					}
@@ -359,17 +363,17 @@ var (
 					j++
 					choices = append(choices, j)
 					choiceNames = append(choiceNames, landmark.Name)
-					fmt.Printf("  (%d) %s [%d coins]: %s\n", j, landmark.Name, landmark.Cost, landmark.Description)
+					printMenu("  (%d) %s [%d coins]: %s", j, landmark.Name, landmark.CostFor(rlr), landmark.Description)
 				}
 
 				var landmarkIdx int
 				var err error
 
 				for {
-					fmt.Print("Which landmark do you want to demolish? ")
-					landmarkIdx, err = scanInt(choices)
+					fmt.Fprint(output, "Which landmark do you want to demolish? ")
+					landmarkIdx, err = promptChoice(choices, choiceNames)
 					if err != nil {
-						fmt.Println("No landmark selected.")
+						fmt.Fprintln(output, "No landmark selected.")
 						continue
 					}
 					break
@@ -377,41 +381,44 @@ var (
 				landmarkName := choiceNames[landmarkIdx-1]
 				rlr.LandmarkCards[landmarkName] = false
 
-				fmt.Printf("Player %d gets 8 coins from the bank [%s].\n", rlr.ID, card.Name)
+				fmt.Fprintf(output, "Player %d gets 8 coins from the bank [%s].\n", rlr.ID, card.Name)
 				remainder := bank.TransferTo(8, &rlr.Coins)
 
 				if remainder > 0 {
-					fmt.Printf("Bank did not have enough money. Missing: %d\n", remainder)
+					fmt.Fprintf(output, "Bank did not have enough money. Missing: %d\n", remainder)
 				}
 			}
 		},
 	}
 
 	tunaBoatEffect = effect{
-		Priority: 1,
+		Priority:    1,
+		SpecialRoll: true,
+		References:  effectReferences{Landmarks: []string{"Harbor"}},
 
 		Description: func() string {
 			return "If you have the [Harbor] landmark. Roller rolls 2 dice and you receive that many coins from the bank on anyone's turn"
 		},
 
 		Call: func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) {
-			if !p.LandmarkCards["Harbor"] {
+			if !p.HasLandmark("Harbor") {
 				return
 			}
 
 			totalPayout := specialRoll * c
 
-			fmt.Printf("Player %d gets %d coins from the bank [%s].\n", p.ID, totalPayout, card.Name)
+			fmt.Fprintf(output, "Player %d gets %d coins from the bank [%s].\n", p.ID, totalPayout, card.Name)
 			remainder := bank.TransferTo(totalPayout, &p.Coins)
 
 			if remainder > 0 {
-				fmt.Printf("Bank did not have enough money. Missing: %d\n", remainder)
+				fmt.Fprintf(output, "Bank did not have enough money. Missing: %d\n", remainder)
 			}
 		},
 	}
 
 	taxOfficeEffect = effect{
-		Priority: 2,
+		Priority:   2,
+		References: effectReferences{Amounts: []int{10}},
 
 		Description: func() string {
 			return "For each players with 10 or more coins, you get half of their coins on your turn only"
@@ -428,18 +435,19 @@ var (
 				}
 				totalPayout := plr.Coins.Total() / 2
 
-				fmt.Printf("Player %d gets %d coins from player %d [%s]\n", rlr.ID, totalPayout, plr.ID, card.Name)
+				fmt.Fprintf(output, "Player %d gets %d coins from player %d [%s]\n", rlr.ID, totalPayout, plr.ID, card.Name)
 				remainder := plr.Coins.TransferTo(totalPayout, &rlr.Coins)
 
 				if remainder > 0 {
-					fmt.Printf("Player %d did not have enough money. Missing: %d\n", plr.ID, remainder)
+					fmt.Fprintf(output, "Player %d did not have enough money. Missing: %d\n", plr.ID, remainder)
 				}
 			}
 		},
 	}
 
 	publisherEffect = effect{
-		Priority: 2,
+		Priority:   2,
+		References: effectReferences{Icons: []cardIcon{cupIcon, breadIcon}, Amounts: []int{1}},
 
 		Description: func() string {
 			return "Get 1 coin from each player for each [Cup] and [Bread] they have on your turn only"
@@ -455,25 +463,21 @@ var (
 					continue
 				}
 
-				iconCards := append(market.FindByIcon("Cup"), market.FindByIcon("Bread")...)
-				iconCardCount := 0
-				for _, iconCard := range iconCards {
-					iconCardCount += plr.SupplyCards[iconCard.Name].Total
-				}
-				totalPayout := 1 * iconCardCount * c
+				totalPayout := 1 * (iconCardCount(plr, cupIcon) + iconCardCount(plr, breadIcon)) * c
 
-				fmt.Printf("Player %d gets %d coins from player %d [%s]\n", rlr.ID, totalPayout, plr.ID, card.Name)
+				fmt.Fprintf(output, "Player %d gets %d coins from player %d [%s]\n", rlr.ID, totalPayout, plr.ID, card.Name)
 				remainder := plr.Coins.TransferTo(totalPayout, &rlr.Coins)
 
 				if remainder > 0 {
-					fmt.Printf("Player %d did not have enough money. Missing: %d\n", plr.ID, remainder)
+					fmt.Fprintf(output, "Player %d did not have enough money. Missing: %d\n", plr.ID, remainder)
 				}
 			}
 		},
 	}
 
 	stadiumEffect = effect{
-		Priority: 2,
+		Priority:   2,
+		References: effectReferences{Amounts: []int{2}},
 
 		Description: func() string {
 			return "Get 2 coins from each player on your turn only"
@@ -486,26 +490,27 @@ var (
 
 			totalPayout := 2 * c
 
-			fmt.Print(card.Effect.Description())
-			fmt.Printf(" [%s]\n", card.Name)
+			fmt.Fprint(output, card.Effect.Description())
+			fmt.Fprintf(output, " [%s]\n", card.Name)
 
 			for _, plr := range plrs {
 				if plr == rlr {
 					continue
 				}
 
-				fmt.Printf("Player %d gets %d coins from player %d [%s]\n", rlr.ID, totalPayout, plr.ID, card.Name)
+				fmt.Fprintf(output, "Player %d gets %d coins from player %d [%s]\n", rlr.ID, totalPayout, plr.ID, card.Name)
 				remainder := plr.Coins.TransferTo(totalPayout, &rlr.Coins)
 
 				if remainder > 0 {
-					fmt.Printf("Player %d did not have enough money. Missing: %d\n", plr.ID, remainder)
+					fmt.Fprintf(output, "Player %d did not have enough money. Missing: %d\n", plr.ID, remainder)
 				}
 			}
 		},
 	}
 
 	tvStationEffect = effect{
-		Priority: 2,
+		Priority:   2,
+		References: effectReferences{Amounts: []int{5}},
 
 		Description: func() string {
 			return "Take 5 coins from any one player on your turn only"
@@ -517,14 +522,14 @@ var (
 			}
 
 			var choices []int
+			var choiceNames []string
 			var choice int
 			var err error
 
 			totalPayout := 5 * c
 
-			fmt.Print(card.Effect.Description())
-			fmt.Printf(" [%s]\n", card.Name)
-			fmt.Println("Pick a player to take coins from: ")
+			fmt.Fprint(output, card.Effect.Description())
+			fmt.Fprintf(output, " [%s]\n", card.Name)
 
 			for _, plr := range plrs {
 				if plr == rlr {
@@ -532,14 +537,16 @@ var (
 				}
 
 				choices = append(choices, plr.ID)
-				fmt.Printf("Player (%d) has %d coins\n", plr.ID, plr.Coins.Total())
+				choiceNames = append(choiceNames, fmt.Sprintf("Player %d", plr.ID))
+				printMenu("Player (%d) has %d coins", plr.ID, plr.Coins.Total())
 			}
 
 			for {
-				choice, err = scanInt(choices)
+				fmt.Fprint(output, "Pick a player to take coins from: ")
+				choice, err = promptChoice(choices, choiceNames)
 
 				if err != nil {
-					fmt.Println(err)
+					fmt.Fprintln(output, err)
 					continue
 				}
 
@@ -548,11 +555,11 @@ var (
 
 			plr := plrs[choice]
 
-			fmt.Printf("Player %d gets %d coins from player %d [%s]\n", rlr.ID, totalPayout, plr.ID, card.Name)
+			fmt.Fprintf(output, "Player %d gets %d coins from player %d [%s]\n", rlr.ID, totalPayout, plr.ID, card.Name)
 			remainder := plr.Coins.TransferTo(totalPayout, &rlr.Coins)
 
 			if remainder > 0 {
-				fmt.Printf("Player %d did not have enough money. Missing: %d\n", plr.ID, remainder)
+				fmt.Fprintf(output, "Player %d did not have enough money. Missing: %d\n", plr.ID, remainder)
 			}
 
 			return
@@ -573,84 +580,80 @@ var (
 
 			for i := 0; i < c; i++ {
 				plrChoices := []int{}
+				plrChoiceNames := []string{}
 				cardChoices := make(map[int][]int)
 				cardChoiceNames := make(map[int][]string)
 
 				for _, plr := range plrs {
 					if plr == rlr {
-						fmt.Printf("Roller has cards:\n")
+						printMenu("Roller has cards:")
 					} else {
-						plrChoices = append(plrChoices, plr.ID)
-						fmt.Printf("Player (%d) has cards:\n", plr.ID)
+						printMenu("Player (%d) has cards:", plr.ID)
 					}
 
 					j := 1
 					for cardName, playerCard := range plr.SupplyCards {
-						currentCard := market.FindByName(cardName)
+						currentCard, ok := market.FindByName(cardName)
 
-						if currentCard.Icon == "Major" || playerCard.Total == 0 {
+						if (ok && currentCard.Icon == majorIcon) || playerCard.Total == 0 {
 							continue
 						}
 						cardChoices[plr.ID] = append(cardChoices[plr.ID], j)
 						cardChoiceNames[plr.ID] = append(cardChoiceNames[plr.ID], cardName)
-						fmt.Printf("  (%d) %s [%d]\n", j, cardName, playerCard.Total)
+						printMenu("  (%d) %s [%s]", j, cardName, playerCard)
 						j++
 					}
+					if plr != rlr && len(cardChoices[plr.ID]) > 0 {
+						plrChoices = append(plrChoices, plr.ID)
+						plrChoiceNames = append(plrChoiceNames, fmt.Sprintf("Player %d", plr.ID))
+					}
 				}
 
-				fmt.Println("Pick a player to trade cards with: ")
-				plrID, err := scanInt(plrChoices)
+				if len(plrChoices) == 0 || len(cardChoices[rlr.ID]) == 0 {
+					menu = nil
+					fmt.Fprintf(output, "There are no establishments to trade [%s].\n", card.Name)
+					return
+				}
+
+				fmt.Fprint(output, "Pick a player to trade cards with: ")
+				plrID, err := promptChoice(plrChoices, plrChoiceNames)
 				if err != nil {
-					fmt.Println(err)
+					fmt.Fprintln(output, err)
 					continue
 				}
 
-				fmt.Println("Pick a card to take: ")
-				takeCardIdx, err := scanInt(cardChoices[plrID])
+				fmt.Fprint(output, "Pick a card to take: ")
+				takeCardIdx, err := promptChoice(cardChoices[plrID], cardChoiceNames[plrID])
 				if err != nil {
-					fmt.Println(err)
+					fmt.Fprintln(output, err)
 					continue
 				}
 				takeCardName := cardChoiceNames[plrID][takeCardIdx-1]
 
-				fmt.Println("Pick a card to give: ")
-				giveCardIdx, err := scanInt(cardChoices[rlr.ID])
+				fmt.Fprint(output, "Pick a card to give: ")
+				giveCardIdx, err := promptChoice(cardChoices[rlr.ID], cardChoiceNames[rlr.ID])
 				if err != nil {
-					fmt.Println(err)
+					fmt.Fprintln(output, err)
 					continue
 				}
 				giveCardName := cardChoiceNames[rlr.ID][giveCardIdx-1]
 
-				fmt.Printf("Player %d trades %s for %s with player %d [%s]\n", rlr.ID, giveCardName, takeCardName, plrID, card.Name)
-				rlr.SupplyCards[giveCardName].Total--
-				takepc, ok := p.SupplyCards[takeCardName]
-				if !ok {
-					takepc = &playerCard{}
-					rlr.SupplyCards[takeCardName] = takepc
+				fmt.Fprintf(output, "Player %d trades %s for %s with player %d [%s]\n", rlr.ID, giveCardName, takeCardName, plrID, card.Name)
+				if err = plrs[plrID].GiveCard(takeCardName, rlr); err != nil {
+					fmt.Fprintln(output, err)
+					continue
 				}
-				takepc.Total++
-
-				for _, plr := range plrs {
-					if plr.ID != plrID {
-						continue
-					}
-
-					p.SupplyCards[takeCardName].Total--
-					givepc, ok := p.SupplyCards[giveCardName]
-					if !ok {
-						givepc = &playerCard{}
-						p.SupplyCards[giveCardName] = givepc
-					}
-					givepc.Total++
+				if err = rlr.GiveCard(giveCardName, plrs[plrID]); err != nil {
+					fmt.Fprintln(output, err)
+					continue
 				}
 			}
 		},
 	}
 
-	landmarkCardsSorted []landmarkCard
-	landmarkCards       map[string]landmarkCard
-
-	gameVersionsSorted = []gameVersion{
+	// builtInGameVersions are the versions of the game, presets can't have
+	// their names.
+	builtInGameVersions = []gameVersion{
 		gameVersion{
 			Name: "Basic",
 			Init: initBasic,
@@ -663,46 +666,296 @@ var (
 			Name: "Millionaire's row",
 			Init: initMillionaire,
 		},
+		gameVersion{
+			Name: "The Harbor and Millionaire's row",
+			Init: initHarborMillionaire,
+		},
+		gameVersion{
+			Name: "Green Valley",
+			Init: initGreenValley,
+		},
+		gameVersion{
+			Name:          "Machi Koro 2",
+			Init:          initMachiKoro2,
+			HasWon:        machiKoro2Won,
+			FreeDieChoice: true,
+		},
+	}
+	gameVersionsSorted = append([]gameVersion{}, builtInGameVersions...)
+
+	cardSetsSorted = []cardSet{
+		cardSet{
+			Name:  "Basic",
+			Cards: basicSupplyCards,
+		},
+		cardSet{
+			Name:  "The Harbor",
+			Cards: harborSupplyCards,
+		},
+		cardSet{
+			Name:  "Millionaire's row",
+			Cards: millionaireSupplyCards,
+		},
+		cardSet{
+			Name:  "Green Valley",
+			Cards: greenValleySupplyCards,
+		},
+		cardSet{
+			Name:  "House rules",
+			Cards: houseRulesSupplyCards,
+		},
 	}
 
+	startingCoins       = 3
+	startingSupplyCards = []string{"Wheat Field", "Bakery"}
+
 	plrs []*player
 
+	// input is where the answers of the players are read from and output is
+	// where the game is shown, decide answers the prompts, rollDice and
+	// rollSpecial roll the dice and drawFrom draws the cards of the market,
+	// at random with drawIndex. announce tells interfaces about turns and
+	// rolls. Scenarios and interfaces replace them.
+	input       io.Reader = os.Stdin
+	output      io.Writer = os.Stdout
+	decide                = decideByLine
+	rollDice              = roll
+	rollSpecial           = rollSpecialDice
+	drawFrom              = drawRandom
+	drawIndex             = rand.Intn
+	announce              = func(a announcement) {}
+
+	// gameDice are the dice that roll and rollSpecialDice roll.
+	gameDice Dice = fairDice{Faces: 6}
+
+	// currentMatch is the setup of the game for the match history.
+	currentMatch matchSetup
+
+	// currentVersion is the version being played and currentTurn the turn
+	// being played, for effects and commands that depend on them.
+	currentVersion gameVersion
+	currentTurn    *turn
+
+	cityHallEffect = landmarkEffect{
+		BeforeBuild: newBankLandmarkPayout(1, "you didn't have any", func(t *turn) bool {
+			return t.Roller.Coins.Total() == 0
+		}),
+	}
+
+	harborEffect = landmarkEffect{
+		Priority: 1,
+
+		AfterRoll: func(landmark landmarkCard, t *turn) {
+			if t.Roll < 10 {
+				return
+			}
+
+			fmt.Fprint(output, "Do you want to add 2 to your roll? ")
+
+			if res := promptBool(); res {
+				t.Roll += 2
+				fmt.Fprintf(output, "Player %d rolls %d [%s]\n", t.Roller.ID, t.Roll, landmark.Name)
+				t.announceRoll()
+			}
+		},
+	}
+
+	trainStationEffect = landmarkEffect{
+		BeforeRoll: func(landmark landmarkCard, t *turn) {
+			t.DieChoice = true
+		},
+	}
+
+	shoppingMallEffect = newIconPayoutBonus(1, cupIcon, breadIcon)
+
+	amusementParkEffect = landmarkEffect{
+		EndOfTurn: func(landmark landmarkCard, t *turn) {
+			if !t.Doubles {
+				return
+			}
+
+			fmt.Fprint(output, "You got doubles, do you want to roll again? ")
+
+			if res := promptBool(); res {
+				t.ExtraTurn = true
+			}
+		},
+	}
+
+	radioTowerEffect = landmarkEffect{
+		AfterRoll: func(landmark landmarkCard, t *turn) {
+			if t.Rerolled {
+				return
+			}
+
+			fmt.Fprint(output, "Do you want to re-roll? ")
+
+			if res := promptBool(); res {
+				t.Reroll = true
+			}
+		},
+	}
+
+	airportEffect = landmarkEffect{
+		AfterBuild: newBankLandmarkPayout(10, "you didn't buy anything", func(t *turn) bool {
+			return !t.Built
+		}),
+	}
+
+	charterhouseEffect = landmarkEffect{
+		BeforeBuild: newBankLandmarkPayout(3, "you rolled 2 dice and received no coins", func(t *turn) bool {
+			return t.DieCount == 2 && t.Roller.Coins.Total() <= t.CoinsBeforePayout
+		}),
+	}
+
+	templeEffect = landmarkEffect{
+		BeforeBuild: func(landmark landmarkCard, t *turn) {
+			if !t.Doubles {
+				return
+			}
+
+			for _, plr := range plrs {
+				if plr == t.Roller {
+					continue
+				}
+
+				fmt.Fprintf(output, "Player %d gets 2 coins from player %d [%s]\n", t.Roller.ID, plr.ID, landmark.Name)
+				remainder := plr.Coins.TransferTo(2, &t.Roller.Coins)
+
+				if remainder > 0 {
+					fmt.Fprintf(output, "Player %d did not have enough money. Missing: %d\n", plr.ID, remainder)
+				}
+			}
+		},
+	}
+
 	cityHall = landmarkCard{
 		Name:        "City Hall",
 		Cost:        0,
+		Effect:      cityHallEffect,
 		Description: "If you have no coins before your building phase, you may take 1 coin from the bank",
 	}
 	harbor = landmarkCard{
 		Name:        "Harbor",
 		Cost:        2,
+		Effect:      harborEffect,
 		Description: "If you roll 10 or higher, you may add 2 to your roll",
 	}
 	trainStation = landmarkCard{
 		Name:        "Train Station",
 		Cost:        4,
+		Effect:      trainStationEffect,
 		Description: "You may roll 1 or 2 dice",
 	}
 	shoppingMall = landmarkCard{
 		Name:        "Shopping Mall",
 		Cost:        10,
+		Effect:      shoppingMallEffect,
 		Description: "Each of your [Cup] and [Bread] establishments earn +1 coin",
 	}
 	amusementPark = landmarkCard{
 		Name:        "Amusement Park",
 		Cost:        16,
+		Effect:      amusementParkEffect,
 		Description: "If you roll doubles take another turn after this one",
 	}
 	radioTower = landmarkCard{
 		Name:        "Radio Tower",
 		Cost:        22,
+		Effect:      radioTowerEffect,
 		Description: "Once every turn you can choose to re-roll your dice",
 	}
 	airport = landmarkCard{
 		Name:        "Airport",
 		Cost:        30,
+		Effect:      airportEffect,
 		Description: "If you do not build on your turn, you may take 10 coins from the bank",
 	}
 
+	machiKoro2LandmarkCards = []landmarkCard{
+		landmarkCard{
+			Name:        "Launch Pad",
+			Costs:       []int{45},
+			WinsGame:    true,
+			Description: "When you build this landmark you win the game",
+		},
+		landmarkCard{
+			Name:        "Shopping Mall",
+			Costs:       []int{10, 14, 22},
+			Global:      true,
+			Effect:      shoppingMallEffect,
+			Description: "Each [Cup] and [Bread] establishment earns +1 coin, for all players",
+		},
+		landmarkCard{
+			Name:        "Farmers Market",
+			Costs:       []int{10, 14, 22},
+			Global:      true,
+			Effect:      newIconPayoutBonus(1, wheatIcon),
+			Description: "Each [Wheat] establishment earns +1 coin, for all players",
+		},
+		landmarkCard{
+			Name:        "Forge",
+			Costs:       []int{12, 16, 22},
+			Global:      true,
+			Effect:      newIconPayoutBonus(1, gearIcon),
+			Description: "Each [Gear] establishment earns +1 coin, for all players",
+		},
+		landmarkCard{
+			Name:        "Amusement Park",
+			Costs:       []int{12, 16, 22},
+			Global:      true,
+			Effect:      amusementParkEffect,
+			Description: "If you roll doubles take another turn after this one, for all players",
+		},
+		landmarkCard{
+			Name:        "Radio Tower",
+			Costs:       []int{12, 16, 22},
+			Global:      true,
+			Effect:      radioTowerEffect,
+			Description: "Once every turn you can choose to re-roll your dice, for all players",
+		},
+		landmarkCard{
+			Name:        "Charterhouse",
+			Costs:       []int{12, 16, 22},
+			Global:      true,
+			Effect:      charterhouseEffect,
+			Description: "If you roll 2 dice and receive no coins, take 3 coins from the bank, for all players",
+		},
+		landmarkCard{
+			Name:        "Temple",
+			Costs:       []int{12, 16, 22},
+			Global:      true,
+			Effect:      templeEffect,
+			Description: "If you roll doubles, take 2 coins from each player, for all players",
+		},
+	}
+
+	launchPad = landmarkCard{
+		Name:        "Launch Pad",
+		Cost:        45,
+		WinsGame:    true,
+		Description: "When you build this landmark you win the game",
+	}
+	loanOfficeLandmark = landmarkCard{
+		Name:        "Loan Office",
+		Cost:        6,
+		Optional:    true,
+		Prereq:      newFewestLandmarksPrereq(),
+		Description: "Only a player with the fewest constructed landmarks (excluding City Hall) can build this landmark. It is not needed to win",
+	}
+
+	allLandmarkCards = []landmarkCard{
+		cityHall,
+		harbor,
+		trainStation,
+		shoppingMall,
+		amusementPark,
+		radioTower,
+		airport,
+		launchPad,
+		loanOfficeLandmark,
+	}
+
 	lessThanTwoLandmarksPrereq = newLandmarkMaxPrereq(2)
 	moreThanTwoLandmarksPrereq = newLandmarkMinPrereq(1)
 
@@ -712,7 +965,8 @@ var (
 			Cost:          1,
 			ActiveNumbers: []int{1},
 			Effect:        newAllBankPayout(1),
-			Icon:          "Wheat",
+			Icon:          wheatIcon,
+			Color:         blueColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -720,7 +974,8 @@ var (
 			Cost:          1,
 			ActiveNumbers: []int{2},
 			Effect:        newAllBankPayout(1),
-			Icon:          "Cow",
+			Icon:          cowIcon,
+			Color:         blueColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -728,7 +983,8 @@ var (
 			Cost:          1,
 			ActiveNumbers: []int{2, 3},
 			Effect:        newRollerBankPayout(1),
-			Icon:          "Bread",
+			Icon:          breadIcon,
+			Color:         greenColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -736,7 +992,8 @@ var (
 			Cost:          2,
 			ActiveNumbers: []int{3},
 			Effect:        newRollerPayout(1),
-			Icon:          "Cup",
+			Icon:          cupIcon,
+			Color:         redColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -744,7 +1001,8 @@ var (
 			Cost:          2,
 			ActiveNumbers: []int{4},
 			Effect:        newRollerBankPayout(3),
-			Icon:          "Bread",
+			Icon:          breadIcon,
+			Color:         greenColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -752,7 +1010,8 @@ var (
 			Cost:          3,
 			ActiveNumbers: []int{5},
 			Effect:        newAllBankPayout(1),
-			Icon:          "Gear",
+			Icon:          gearIcon,
+			Color:         blueColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -760,7 +1019,8 @@ var (
 			Cost:          6,
 			ActiveNumbers: []int{6},
 			Effect:        stadiumEffect,
-			Icon:          "Major",
+			Icon:          majorIcon,
+			Color:         purpleColor,
 			Supply:        4,
 		},
 		&supplyCard{
@@ -768,7 +1028,8 @@ var (
 			Cost:          7,
 			ActiveNumbers: []int{6},
 			Effect:        tvStationEffect,
-			Icon:          "Major",
+			Icon:          majorIcon,
+			Color:         purpleColor,
 			Supply:        4,
 		},
 		&supplyCard{
@@ -776,23 +1037,26 @@ var (
 			Cost:          8,
 			ActiveNumbers: []int{6},
 			Effect:        businessCenterEffect,
-			Icon:          "Major",
+			Icon:          majorIcon,
+			Color:         purpleColor,
 			Supply:        4,
 		},
 		&supplyCard{
 			Name:          "Cheese Factory",
 			Cost:          5,
 			ActiveNumbers: []int{7},
-			Effect:        newIconCardPayout(3, "Cow"),
-			Icon:          "Factory",
+			Effect:        newIconCardPayout(3, cowIcon),
+			Icon:          factoryIcon,
+			Color:         greenColor,
 			Supply:        6,
 		},
 		&supplyCard{
 			Name:          "Furniture Factory",
 			Cost:          3,
 			ActiveNumbers: []int{8},
-			Effect:        newIconCardPayout(3, "Gear"),
-			Icon:          "Factory",
+			Effect:        newIconCardPayout(3, gearIcon),
+			Icon:          factoryIcon,
+			Color:         greenColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -800,7 +1064,8 @@ var (
 			Cost:          6,
 			ActiveNumbers: []int{9},
 			Effect:        newAllBankPayout(5),
-			Icon:          "Gear",
+			Icon:          gearIcon,
+			Color:         blueColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -808,7 +1073,8 @@ var (
 			Cost:          3,
 			ActiveNumbers: []int{9, 10},
 			Effect:        newRollerPayout(2),
-			Icon:          "Cup",
+			Icon:          cupIcon,
+			Color:         redColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -816,15 +1082,17 @@ var (
 			Cost:          3,
 			ActiveNumbers: []int{10},
 			Effect:        newAllBankPayout(3),
-			Icon:          "Wheat",
+			Icon:          wheatIcon,
+			Color:         blueColor,
 			Supply:        6,
 		},
 		&supplyCard{
 			Name:          "Fruit and Vegetable Market",
 			Cost:          2,
 			ActiveNumbers: []int{11, 12},
-			Effect:        newIconCardPayout(2, "Wheat"),
-			Icon:          "Fruit",
+			Effect:        newIconCardPayout(2, wheatIcon),
+			Icon:          fruitIcon,
+			Color:         greenColor,
 			Supply:        6,
 		},
 	}
@@ -835,7 +1103,8 @@ var (
 			Cost:          1,
 			ActiveNumbers: []int{7},
 			Effect:        newRollerPayout(1),
-			Icon:          "Cup",
+			Icon:          cupIcon,
+			Color:         redColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -843,7 +1112,8 @@ var (
 			Cost:          4,
 			ActiveNumbers: []int{8, 9},
 			Effect:        taxOfficeEffect,
-			Icon:          "Major",
+			Icon:          majorIcon,
+			Color:         purpleColor,
 			Supply:        4,
 		},
 		&supplyCard{
@@ -851,7 +1121,8 @@ var (
 			Cost:          1,
 			ActiveNumbers: []int{8},
 			Effect:        newRollerPayout(1),
-			Icon:          "Cup",
+			Icon:          cupIcon,
+			Color:         redColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -859,7 +1130,8 @@ var (
 			Cost:          1,
 			ActiveNumbers: []int{1},
 			Effect:        newRollerPayoutWithPrereq(1, newLandmarkPrereq("Harbor", false)),
-			Icon:          "Cup",
+			Icon:          cupIcon,
+			Color:         redColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -867,7 +1139,8 @@ var (
 			Cost:          2,
 			ActiveNumbers: []int{4},
 			Effect:        newAllBankPayout(1),
-			Icon:          "Wheat",
+			Icon:          wheatIcon,
+			Color:         blueColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -875,15 +1148,17 @@ var (
 			Cost:          1,
 			ActiveNumbers: []int{2},
 			Effect:        newCardPayout(1, "Flower Garden"),
-			Icon:          "Bread",
+			Icon:          breadIcon,
+			Color:         greenColor,
 			Supply:        6,
 		},
 		&supplyCard{
 			Name:          "Food Warehouse",
 			Cost:          2,
 			ActiveNumbers: []int{12, 13},
-			Effect:        newIconCardPayout(2, "Cup"),
-			Icon:          "Factory",
+			Effect:        newIconCardPayout(2, cupIcon),
+			Icon:          factoryIcon,
+			Color:         greenColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -891,7 +1166,8 @@ var (
 			Cost:          2,
 			ActiveNumbers: []int{8},
 			Effect:        newAllBankPayout(2),
-			Icon:          "Boat",
+			Icon:          boatIcon,
+			Color:         blueColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -899,7 +1175,8 @@ var (
 			Cost:          5,
 			ActiveNumbers: []int{7},
 			Effect:        publisherEffect,
-			Icon:          "Major",
+			Icon:          majorIcon,
+			Color:         purpleColor,
 			Supply:        4,
 		},
 		&supplyCard{
@@ -907,7 +1184,8 @@ var (
 			Cost:          5,
 			ActiveNumbers: []int{12, 13, 14},
 			Effect:        tunaBoatEffect,
-			Icon:          "Boat",
+			Icon:          boatIcon,
+			Color:         blueColor,
 			Supply:        6,
 		},
 	}
@@ -918,7 +1196,8 @@ var (
 			Cost:          0,
 			ActiveNumbers: []int{2},
 			Effect:        newRollerBankPayoutWithPrereq(2, lessThanTwoLandmarksPrereq),
-			Icon:          "Bread",
+			Icon:          breadIcon,
+			Color:         greenColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -926,7 +1205,8 @@ var (
 			Cost:          2,
 			ActiveNumbers: []int{3, 4},
 			Effect:        newAllBankPayoutWithPrereq(1, lessThanTwoLandmarksPrereq),
-			Icon:          "Wheat",
+			Icon:          wheatIcon,
+			Color:         blueColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -934,7 +1214,8 @@ var (
 			Cost:          2,
 			ActiveNumbers: []int{4},
 			Effect:        demolitionCompanyEffect,
-			Icon:          "Suitcase",
+			Icon:          suitcaseIcon,
+			Color:         greenColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -942,7 +1223,8 @@ var (
 			Cost:          -5,
 			ActiveNumbers: []int{5, 6},
 			Effect:        newBankRollerPayout(2),
-			Icon:          "Suitcase",
+			Icon:          suitcaseIcon,
+			Color:         greenColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -950,7 +1232,8 @@ var (
 			Cost:          3,
 			ActiveNumbers: []int{5},
 			Effect:        newRollerPayoutWithPrereq(5, moreThanTwoLandmarksPrereq),
-			Icon:          "Cup",
+			Icon:          cupIcon,
+			Color:         redColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -958,7 +1241,8 @@ var (
 			Cost:          3,
 			ActiveNumbers: []int{7},
 			Effect:        newAllBankPayout(3),
-			Icon:          "Wheat",
+			Icon:          wheatIcon,
+			Color:         blueColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -966,7 +1250,8 @@ var (
 			Cost:          4,
 			ActiveNumbers: []int{8},
 			Effect:        renovationCompanyEffect,
-			Icon:          "Major",
+			Icon:          majorIcon,
+			Color:         purpleColor,
 			Supply:        4,
 		},
 		&supplyCard{
@@ -974,7 +1259,8 @@ var (
 			Cost:          2,
 			ActiveNumbers: []int{9, 10},
 			Effect:        movingCompanyEffect,
-			Icon:          "Suitcase",
+			Icon:          suitcaseIcon,
+			Color:         greenColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -982,7 +1268,8 @@ var (
 			Cost:          3,
 			ActiveNumbers: []int{9},
 			Effect:        wineryEffect,
-			Icon:          "Factory",
+			Icon:          factoryIcon,
+			Color:         greenColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -990,7 +1277,8 @@ var (
 			Cost:          1,
 			ActiveNumbers: []int{10},
 			Effect:        techStartupEffect,
-			Icon:          "Major",
+			Icon:          majorIcon,
+			Color:         purpleColor,
 			Supply:        4,
 		},
 		&supplyCard{
@@ -998,7 +1286,8 @@ var (
 			Cost:          5,
 			ActiveNumbers: []int{11},
 			Effect:        sodaBottlingPlantEffect,
-			Icon:          "Factory",
+			Icon:          factoryIcon,
+			Color:         greenColor,
 			Supply:        6,
 		},
 		&supplyCard{
@@ -1006,7 +1295,8 @@ var (
 			Cost:          3,
 			ActiveNumbers: []int{11, 12, 13},
 			Effect:        parkEffect,
-			Icon:          "Major",
+			Icon:          majorIcon,
+			Color:         purpleColor,
 			Supply:        4,
 		},
 		&supplyCard{
@@ -1014,33 +1304,337 @@ var (
 			Cost:          4,
 			ActiveNumbers: []int{12, 13, 14},
 			Effect:        membersOnlyClubEffect,
-			Icon:          "Cup",
+			Icon:          cupIcon,
+			Color:         redColor,
+			Supply:        6,
+		},
+	}
+
+	greenValleySupplyCards = []*supplyCard{
+		&supplyCard{
+			Name:          "Rice Paddy",
+			Cost:          2,
+			ActiveNumbers: []int{1, 2},
+			Effect:        newAllBankPayoutWithPrereq(2, lessThanTwoLandmarksPrereq),
+			Icon:          wheatIcon,
+			Color:         blueColor,
+			Supply:        6,
+		},
+		&supplyCard{
+			Name:          "Construction Site",
+			Cost:          1,
+			ActiveNumbers: []int{2},
+			Effect:        newSelfRenovationPayout(3),
+			Icon:          suitcaseIcon,
+			Color:         greenColor,
+			Supply:        6,
+		},
+		&supplyCard{
+			Name:          "Pawn Shop",
+			Cost:          -3,
+			ActiveNumbers: []int{3},
+			Effect:        newBankRollerPayout(1),
+			Icon:          suitcaseIcon,
+			Color:         greenColor,
+			Supply:        6,
+		},
+		&supplyCard{
+			Name:          "Salvage Yard",
+			Cost:          3,
+			ActiveNumbers: []int{5, 6},
+			Effect:        newClosedCardPayout(2),
+			Icon:          gearIcon,
+			Color:         greenColor,
+			Supply:        6,
+		},
+		&supplyCard{
+			Name:          "Contractor",
+			Cost:          2,
+			ActiveNumbers: []int{6},
+			Effect:        newReopenEffect(1),
+			Icon:          suitcaseIcon,
+			Color:         greenColor,
+			Supply:        6,
+		},
+		&supplyCard{
+			Name:          "Lottery Office",
+			Cost:          4,
+			ActiveNumbers: []int{7},
+			Effect:        newRollerBankPayoutWithPrereq(8, newSpecialRollMinPrereq(10)),
+			Icon:          suitcaseIcon,
+			Color:         greenColor,
+			Supply:        6,
+		},
+		&supplyCard{
+			Name:          "Sake Brewery",
+			Cost:          4,
+			ActiveNumbers: []int{8},
+			Effect:        newCardPayout(3, "Rice Paddy"),
+			Icon:          factoryIcon,
+			Color:         greenColor,
+			Supply:        6,
+		},
+		&supplyCard{
+			Name:          "Sports Bar",
+			Cost:          3,
+			ActiveNumbers: []int{8, 9},
+			Effect:        newRollerPayoutWithPrereq(3, moreThanTwoLandmarksPrereq),
+			Icon:          cupIcon,
+			Color:         redColor,
+			Supply:        6,
+		},
+	}
+
+	// houseRulesSupplyCards are not from a box of the game, custom versions
+	// can include them.
+	houseRulesSupplyCards = []*supplyCard{
+		&supplyCard{
+			Name:          "Tool Shed",
+			Cost:          2,
+			ActiveNumbers: []int{5},
+			Effect:        newRollerBankPayoutWithPrereq(3, newAndPrereq(newIconMinPrereq(gearIcon, 2), newCoinsMaxPrereq(10))),
+			Icon:          gearIcon,
+			Color:         greenColor,
+			Supply:        6,
+		},
+		&supplyCard{
+			Name:          "Night Market",
+			Cost:          3,
+			ActiveNumbers: []int{9},
+			Effect:        newAllBankPayoutWithPrereq(2, newOrPrereq(newNotPrereq(newRollerPrereq()), newCoinsMaxPrereq(5))),
+			Icon:          cupIcon,
+			Color:         blueColor,
+			Supply:        6,
+		},
+		&supplyCard{
+			Name:          "Village Fair",
+			Cost:          2,
+			ActiveNumbers: []int{10, 11, 12},
+			Effect:        newAllBankPayoutWithPrereq(2, newOrPrereq(newRollRangePrereq(11, 12), newAndPrereq(newPlayerCountPrereq(3, 4), newCoinsMaxPrereq(5)))),
+			Icon:          wheatIcon,
+			Color:         blueColor,
 			Supply:        6,
 		},
 	}
-)
 
-func postInit() {
-	landmarkCards = make(map[string]landmarkCard)
-	for _, card := range landmarkCardsSorted {
-		landmarkCards[card.Name] = card
+	machiKoro2SupplyCards = []*supplyCard{
+		&supplyCard{
+			Name:          "Wheat Field",
+			Cost:          1,
+			ActiveNumbers: []int{1},
+			Effect:        newAllBankPayout(1),
+			Icon:          wheatIcon,
+			Color:         blueColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Vineyard",
+			Cost:          1,
+			ActiveNumbers: []int{2},
+			Effect:        newAllBankPayout(2),
+			Icon:          wheatIcon,
+			Color:         blueColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Bakery",
+			Cost:          1,
+			ActiveNumbers: []int{2, 3},
+			Effect:        newRollerBankPayout(2),
+			Icon:          breadIcon,
+			Color:         greenColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Cafe",
+			Cost:          1,
+			ActiveNumbers: []int{3},
+			Effect:        newRollerPayout(2),
+			Icon:          cupIcon,
+			Color:         redColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Flower Garden",
+			Cost:          2,
+			ActiveNumbers: []int{4},
+			Effect:        newAllBankPayout(2),
+			Icon:          wheatIcon,
+			Color:         blueColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Convenience Store",
+			Cost:          1,
+			ActiveNumbers: []int{4},
+			Effect:        newRollerBankPayout(3),
+			Icon:          breadIcon,
+			Color:         greenColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Forest",
+			Cost:          3,
+			ActiveNumbers: []int{5},
+			Effect:        newAllBankPayout(2),
+			Icon:          gearIcon,
+			Color:         blueColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Flower Shop",
+			Cost:          1,
+			ActiveNumbers: []int{6},
+			Effect:        newCardPayout(3, "Flower Garden"),
+			Icon:          breadIcon,
+			Color:         greenColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Business Center",
+			Cost:          3,
+			ActiveNumbers: []int{6},
+			Effect:        businessCenterEffect,
+			Icon:          majorIcon,
+			Color:         purpleColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Stadium",
+			Cost:          3,
+			ActiveNumbers: []int{7},
+			Effect:        stadiumEffect,
+			Icon:          majorIcon,
+			Color:         purpleColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Mackerel Boat",
+			Cost:          2,
+			ActiveNumbers: []int{7, 8},
+			Effect:        newAllBankPayout(3),
+			Icon:          boatIcon,
+			Color:         blueColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Hamburger Stand",
+			Cost:          1,
+			ActiveNumbers: []int{8},
+			Effect:        newRollerPayout(2),
+			Icon:          cupIcon,
+			Color:         redColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Furniture Factory",
+			Cost:          4,
+			ActiveNumbers: []int{8},
+			Effect:        newIconCardPayout(4, gearIcon),
+			Icon:          factoryIcon,
+			Color:         greenColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Publisher",
+			Cost:          4,
+			ActiveNumbers: []int{8},
+			Effect:        publisherEffect,
+			Icon:          majorIcon,
+			Color:         purpleColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Winery",
+			Cost:          3,
+			ActiveNumbers: []int{9},
+			Effect:        newCardPayout(3, "Vineyard"),
+			Icon:          factoryIcon,
+			Color:         greenColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Family Restaurant",
+			Cost:          2,
+			ActiveNumbers: []int{9, 10},
+			Effect:        newRollerPayout(2),
+			Icon:          cupIcon,
+			Color:         redColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Apple Orchard",
+			Cost:          1,
+			ActiveNumbers: []int{10},
+			Effect:        newAllBankPayout(3),
+			Icon:          wheatIcon,
+			Color:         blueColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Food Warehouse",
+			Cost:          2,
+			ActiveNumbers: []int{10, 11},
+			Effect:        newIconCardPayout(2, cupIcon),
+			Icon:          factoryIcon,
+			Color:         greenColor,
+			Supply:        5,
+		},
+		&supplyCard{
+			Name:          "Mine",
+			Cost:          4,
+			ActiveNumbers: []int{11, 12},
+			Effect:        newAllBankPayout(6),
+			Icon:          gearIcon,
+			Color:         blueColor,
+			Supply:        5,
+		},
 	}
+)
+
+func initBasic() error {
+	var err error
+	market, err = newBasicMarketplace(basicSupplyCards, []landmarkCard{
+		trainStation,
+		shoppingMall,
+		amusementPark,
+		radioTower,
+	})
+
+	return err
 }
 
-func initBasic() {
-	market = newBasicMarketplace(basicSupplyCards)
-	landmarkCardsSorted = []landmarkCard{
+func initHarbor() error {
+	var err error
+	market, err = newExpansionMarketplace(append(basicSupplyCards, harborSupplyCards...), []landmarkCard{
+		cityHall,
+		harbor,
 		trainStation,
 		shoppingMall,
 		amusementPark,
 		radioTower,
-	}
-	postInit()
+		airport,
+	})
+
+	return err
 }
 
-func initHarbor() {
-	market = newExpansionMarketplace(append(basicSupplyCards, harborSupplyCards...))
-	landmarkCardsSorted = []landmarkCard{
+func initMillionaire() error {
+	var err error
+	market, err = newExpansionMarketplace(append(basicSupplyCards, millionaireSupplyCards...), []landmarkCard{
+		cityHall,
+		trainStation,
+		shoppingMall,
+		amusementPark,
+		radioTower,
+	})
+
+	return err
+}
+
+func initHarborMillionaire() error {
+	var err error
+	market, err = newExpansionMarketplace(append(append(basicSupplyCards, harborSupplyCards...), millionaireSupplyCards...), []landmarkCard{
 		cityHall,
 		harbor,
 		trainStation,
@@ -1048,20 +1642,88 @@ func initHarbor() {
 		amusementPark,
 		radioTower,
 		airport,
-	}
-	postInit()
+	})
+
+	return err
 }
 
-func initMillionaire() {
-	market = newExpansionMarketplace(append(basicSupplyCards, millionaireSupplyCards...))
-	landmarkCardsSorted = []landmarkCard{
+func initGreenValley() error {
+	var err error
+	market, err = newExpansionMarketplace(append(basicSupplyCards, greenValleySupplyCards...), []landmarkCard{
 		cityHall,
 		trainStation,
 		shoppingMall,
 		amusementPark,
 		radioTower,
+		loanOfficeLandmark,
+		launchPad,
+	})
+
+	return err
+}
+
+func initMachiKoro2() error {
+	var err error
+	market, err = newMachiKoro2Marketplace(machiKoro2SupplyCards, machiKoro2LandmarkCards)
+	startingCoins = 5
+	startingSupplyCards = []string{}
+
+	return err
+}
+
+// saveGlobals saves the game state held in globals, and returns a function
+// that restores it. It lets commands set up versions without affecting each
+// other. The supply of all cards is saved, because setting up a market takes
+// cards from it.
+func saveGlobals() func() {
+	savedMarket := market
+	savedBank := bank
+	savedPlrs := plrs
+	savedVersion := currentVersion
+	savedTurn := currentTurn
+	savedCoins := startingCoins
+	savedStartingCards := startingSupplyCards
+	savedInput := input
+	savedOutput := output
+	savedDecide := decide
+	savedRollDice := rollDice
+	savedRollSpecial := rollSpecial
+	savedDrawFrom := drawFrom
+	savedDrawIndex := drawIndex
+	savedDice := gameDice
+	savedAnnounce := announce
+
+	var cards []*supplyCard
+	for _, set := range cardSetsSorted {
+		cards = append(cards, set.Cards...)
+	}
+	cards = append(cards, machiKoro2SupplyCards...)
+	supplies := make([]int, len(cards))
+	for i, card := range cards {
+		supplies[i] = card.Supply
+	}
+
+	return func() {
+		for i, card := range cards {
+			card.Supply = supplies[i]
+		}
+		market = savedMarket
+		bank = savedBank
+		plrs = savedPlrs
+		currentVersion = savedVersion
+		currentTurn = savedTurn
+		startingCoins = savedCoins
+		startingSupplyCards = savedStartingCards
+		input = savedInput
+		output = savedOutput
+		decide = savedDecide
+		rollDice = savedRollDice
+		rollSpecial = savedRollSpecial
+		drawFrom = savedDrawFrom
+		drawIndex = savedDrawIndex
+		gameDice = savedDice
+		announce = savedAnnounce
 	}
-	postInit()
 }
 
 func init() {
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// errNoChoice is returned by the prompts when the player answers with an
+// empty line, which cancels optional choices like buying an establishment.
+var errNoChoice = errors.New("No choice made")
+
+// errGameQuit is returned by playGame when the player quits or the input
+// ends.
+var errGameQuit = errors.New("The game was quit")
+
+// gameQuit is the panic used to stop the game from any prompt.
+type gameQuit struct{}
+
+const saveFile = "save.json"
+
+// savedGame is a game saved with the save command, a scenario without turns
+// and the player whose turn is next. The layout of the market and the bank
+// are saved too, so that the game goes on with the same deck.
+type savedGame struct {
+	scenario
+	NextPlayer   int          `json:"next_player"`
+	MarketLayout marketLayout `json:"market_layout"`
+	Bank         *coinSet     `json:"bank"`
+}
+
+// decisionRequest describes what a prompt asks for, so that an interface can
+// offer the legal choices instead of parsing the text of the prompt.
+type decisionRequest struct {
+	Kind     string           `json:"kind"`
+	Prompt   string           `json:"prompt"`
+	Choices  []decisionChoice `json:"choices,omitempty"`
+	Optional bool             `json:"optional"`
+	// Menu are the lines describing the choices, like the costs of the
+	// establishments, for the player who makes the decision.
+	Menu []string `json:"menu,omitempty"`
+}
+
+type decisionChoice struct {
+	Value int    `json:"value"`
+	Label string `json:"label,omitempty"`
+}
+
+const (
+	boolDecision   = "bool"
+	choiceDecision = "choice"
+	textDecision   = "text"
+)
+
+// decideByLine answers a prompt with a line of the input. Game commands can
+// be given instead of answers, except to questions that ask for a text.
+func decideByLine(req decisionRequest) string {
+	if req.Kind == textDecision {
+		return readLine()
+	}
+
+	return promptAnswer()
+}
+
+// menu are the lines of the menu of the next choice, and menusInDecisions
+// keeps them out of the output, for interfaces that send them with the
+// decision to the player who makes it.
+var (
+	menu             []string
+	menusInDecisions bool
+)
+
+// printMenu prints a line of the menu of the next choice.
+func printMenu(format string, a ...interface{}) {
+	line := fmt.Sprintf(format, a...)
+	menu = append(menu, line)
+	if !menusInDecisions {
+		fmt.Fprintln(output, line)
+	}
+}
+
+// pushedLines are answers given ahead of time, like the name in "buy cheese"
+// given to the question if you want to buy an establishment.
+var pushedLines []string
+
+// readLine reads a line of the input. At the end of the input the game is
+// quit, instead of answering every prompt with nothing.
+func readLine() string {
+	if len(pushedLines) > 0 {
+		line := pushedLines[0]
+		pushedLines = pushedLines[1:]
+		return line
+	}
+
+	var line []byte
+	b := make([]byte, 1)
+
+	for {
+		n, err := input.Read(b)
+		if n == 0 || err != nil {
+			if len(line) == 0 {
+				panic(gameQuit{})
+			}
+			break
+		}
+		if b[0] == '\n' {
+			break
+		}
+		line = append(line, b[0])
+	}
+
+	return strings.TrimSpace(string(line))
+}
+
+// promptLine reads a line as it is, for answers like names that can contain
+// spaces or look like commands.
+func promptLine() string {
+	return decide(decisionRequest{Kind: textDecision})
+}
+
+// promptAnswer reads a line and runs the game commands in it, until the line
+// is an answer to the prompt.
+func promptAnswer() string {
+	for {
+		line := readLine()
+		if !runGameCommand(line) {
+			return line
+		}
+		fmt.Fprint(output, "Your answer: ")
+	}
+}
+
+func promptBool() bool {
+	fmt.Fprint(output, "(y/n) ")
+
+	for {
+		answer := decide(decisionRequest{
+			Kind: boolDecision,
+			Choices: []decisionChoice{
+				decisionChoice{Value: 1, Label: "yes"},
+				decisionChoice{Value: 0, Label: "no"},
+			},
+		})
+
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+
+		// "buy cheese" answers yes to buying and names the card to buy.
+		for _, verb := range []string{"buy ", "build "} {
+			if strings.HasPrefix(strings.ToLower(answer), verb) {
+				pushedLines = append(pushedLines, strings.TrimSpace(answer[len(verb):]))
+				return true
+			}
+		}
+
+		fmt.Fprintf(output, "Invalid input '%s', answer y or n: ", answer)
+	}
+}
+
+func joinInts(values []int) string {
+	strInts := make([]string, len(values))
+	for i, v := range values {
+		strInts[i] = strconv.Itoa(v)
+	}
+
+	return strings.Join(strInts, ", ")
+}
+
+// scanInt asks for one of the numbers until the answer is valid.
+func scanInt(oneOf []int) (int, error) {
+	return promptChoice(oneOf, nil)
+}
+
+// promptChoice asks for one of the numbers, or for the name that belongs to
+// it. Names don't have to be complete, "cheese" picks "Cheese Factory". A
+// choice has to be made, an empty answer is asked again. Only when there is
+// nothing to choose from errNoChoice is returned.
+func promptChoice(oneOf []int, names []string) (int, error) {
+	return askChoice(oneOf, names, false)
+}
+
+// promptOptionalChoice is promptChoice for a choice that can be skipped, like
+// buying an establishment. An empty answer returns errNoChoice.
+func promptOptionalChoice(oneOf []int, names []string) (int, error) {
+	return askChoice(oneOf, names, true)
+}
+
+func askChoice(oneOf []int, names []string, optional bool) (int, error) {
+	req := decisionRequest{Kind: choiceDecision, Optional: optional, Menu: menu}
+	menu = nil
+	for i, v := range oneOf {
+		choice := decisionChoice{Value: v}
+		if i < len(names) {
+			choice.Label = names[i]
+		}
+		req.Choices = append(req.Choices, choice)
+	}
+
+	if len(oneOf) == 0 {
+		return 0, errNoChoice
+	}
+
+	for {
+		answer := decide(req)
+		if answer == "" && optional {
+			return 0, errNoChoice
+		}
+		if answer == "" {
+			fmt.Fprintf(output, "A choice has to be made (%s), try again: ", joinInts(oneOf))
+			continue
+		}
+
+		if val, err := strconv.Atoi(answer); err == nil {
+			for _, v := range oneOf {
+				if v == val {
+					return val, nil
+				}
+			}
+			fmt.Fprintf(output, "Invalid input '%d' for values (%s), try again: ", val, joinInts(oneOf))
+			continue
+		}
+
+		if len(names) == 0 {
+			fmt.Fprintf(output, "Invalid input '%s' for values (%s), try again: ", answer, joinInts(oneOf))
+			continue
+		}
+
+		idx, err := matchName(answer, names)
+		if err != nil {
+			fmt.Fprintf(output, "%s, try again: ", err)
+			continue
+		}
+
+		return oneOf[idx], nil
+	}
+}
+
+// matchName finds the name that the query means. A complete name is the best
+// match, then names starting with the query, then names containing it, then
+// names containing its letters in order.
+func matchName(query string, names []string) (int, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	for _, verb := range []string{"buy ", "build ", "pick ", "take ", "give "} {
+		query = strings.TrimPrefix(query, verb)
+	}
+
+	matchers := []func(name string) bool{
+		func(name string) bool { return name == query },
+		func(name string) bool { return strings.HasPrefix(name, query) },
+		func(name string) bool { return strings.Contains(name, query) },
+		func(name string) bool { return isSubsequence(query, name) },
+	}
+
+	for _, matches := range matchers {
+		var found []int
+		for i, name := range names {
+			if matches(strings.ToLower(name)) {
+				found = append(found, i)
+			}
+		}
+
+		if len(found) == 1 {
+			return found[0], nil
+		}
+		if len(found) > 1 {
+			var candidates []string
+			for _, i := range found {
+				candidates = append(candidates, names[i])
+			}
+			return 0, fmt.Errorf("'%s' could be %s", query, strings.Join(candidates, ", "))
+		}
+	}
+
+	return 0, fmt.Errorf("'%s' does not match any choice", query)
+}
+
+func isSubsequence(query string, name string) bool {
+	i := 0
+	for _, r := range name {
+		if i < len(query) && rune(query[i]) == r {
+			i++
+		}
+	}
+
+	return i == len(query)
+}
+
+// runGameCommand runs the command in the line and reports if it was one.
+// Commands can be given at any prompt.
+func runGameCommand(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+	args := strings.TrimSpace(line[len(fields[0]):])
+
+	switch strings.ToLower(fields[0]) {
+	case "status":
+		for _, p := range plrs {
+			printPlayerCards(p)
+		}
+	case "market":
+		printMarket()
+	case "help":
+		printHelp(args)
+	case "forecast":
+		printForecast()
+	case "save":
+		if err := saveGame(args); err != nil {
+			fmt.Fprintln(output, err)
+		}
+	case "quit":
+		panic(gameQuit{})
+	default:
+		return false
+	}
+
+	return true
+}
+
+func printMarket() {
+	fmt.Fprintln(output, "Market:")
+	for _, cardCount := range market.Query().InStock().SortBy(byActiveNumber).Counts() {
+		card := cardCount.Card
+		fmt.Fprintf(output, "  %s (%s, %s) [%d coins] (%d left) active on %s\n", card.Name, card.Color, card.Icon, card.Cost, cardCount.Count, joinInts(card.ActiveNumbers))
+	}
+}
+
+func printHelp(name string) {
+	if name == "" {
+		fmt.Fprintln(output, "Commands, at any prompt:")
+		fmt.Fprintln(output, "  status       Show the cards and coins of all players")
+		fmt.Fprintln(output, "  market       Show the establishments on the market")
+		fmt.Fprintln(output, "  help <card>  Show what an establishment or a landmark does")
+		fmt.Fprintln(output, "  forecast     Show which establishments each roll activates")
+		fmt.Fprintln(output, "  save [file]  Save the game, to go on with the resume command")
+		fmt.Fprintln(output, "  quit         Quit the game")
+		fmt.Fprintln(output, "Choices can be made by number or by name, like 'buy cheese'.")
+		return
+	}
+
+	var names []string
+	for _, card := range market.Cards {
+		names = append(names, card.Name)
+	}
+	for _, landmark := range market.LandmarkCards {
+		names = append(names, landmark.Name)
+	}
+
+	idx, err := matchName(name, names)
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return
+	}
+
+	if idx < len(market.Cards) {
+		card := market.Cards[idx]
+		fmt.Fprintf(output, "%s (%s, %s) [%d coins] active on %s: %s\n", card.Name, card.Color, card.Icon, card.Cost, joinInts(card.ActiveNumbers), card.Effect.Description())
+		return
+	}
+
+	landmark := market.LandmarkCards[idx-len(market.Cards)]
+	cost := landmark.Cost
+	if currentTurn != nil {
+		cost = landmark.CostFor(currentTurn.Roller)
+	}
+	fmt.Fprintf(output, "%s [%d coins]: %s%s\n", landmark.Name, cost, landmark.Prereq.Desc, landmark.Description)
+}
+
+// printForecast shows the chance of each roll and the establishments of the
+// players that it activates.
+func printForecast() {
+	oneDie := rollChances(1)
+	twoDice := rollChances(2)
+
+	fmt.Fprintln(output, "Roll  1 die  2 dice  Establishments")
+	for roll := 1; roll <= maxDiceRoll(); roll++ {
+		var owners []string
+		for _, card := range market.FindByRoll(roll) {
+			for _, p := range plrs {
+				if pc, ok := p.SupplyCards[card.Name]; ok && pc.Total > 0 {
+					owners = append(owners, fmt.Sprintf("%s x%d (Player %d)", card.Name, pc.Total, p.ID))
+				}
+			}
+		}
+
+		fmt.Fprintf(output, "%4d  %5.1f%%  %5.1f%%  %s\n", roll, oneDie[roll]*100, twoDice[roll]*100, strings.Join(owners, ", "))
+	}
+}
+
+func savePath(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, saveFile), nil
+}
+
+// saveGame saves the state of the game as a scenario without turns, which can
+// be resumed or used as the start of a rules scenario. A turn that is saved
+// after the roll is over, the game resumes with the next player.
+func saveGame(path string) error {
+	if len(plrs) == 0 {
+		return errors.New("There is no game to save yet")
+	}
+
+	path, err := savePath(path)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	saved := savedGame{
+		scenario:     scenario{Name: "Saved game", gameState: gameSnapshot()},
+		MarketLayout: market.saveLayout(),
+		Bank:         &bank,
+	}
+	if currentTurn != nil {
+		saved.NextPlayer = currentTurn.Roller.ID
+		if currentTurn.Dice != nil {
+			saved.NextPlayer = (saved.NextPlayer + 1) % len(plrs)
+		}
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(output, "Saved the game to %s, it resumes with the turn of player %d\n", path, saved.NextPlayer)
+
+	return nil
+}
+
+// runResume plays the rest of a saved game. Resumed games are not kept in the
+// match history, which replays games from their start.
+func runResume(args []string) error {
+	if len(args) > 1 {
+		return errors.New("Use resume [file]")
+	}
+	var path string
+	if len(args) == 1 {
+		path = args[0]
+	}
+	path, err := savePath(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var saved savedGame
+	if err = json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("Could not read the saved game %s: %s", path, err)
+	}
+
+	restore := saveGlobals()
+	defer restore()
+
+	// The version sets up its own layout, which is then put back the way it
+	// was saved.
+	onMarket := saved.Market
+	saved.Market = nil
+	version, err := saved.setUp()
+	if err != nil {
+		return err
+	}
+	if err = market.restoreLayout(onMarket, saved.MarketLayout); err != nil {
+		return err
+	}
+	if saved.Bank != nil {
+		bank = *saved.Bank
+	}
+	currentVersion = version
+	if saved.NextPlayer < 0 || saved.NextPlayer >= len(plrs) {
+		return fmt.Errorf("The saved game has no player %d", saved.NextPlayer)
+	}
+
+	fmt.Fprintf(output, "machi koro! Resuming %s with the turn of player %d\n", version.Name, saved.NextPlayer)
+	err = func() (err error) {
+		defer recoverQuit(&err)
+		return playTurns(version, saved.NextPlayer)
+	}()
+	if err == errGameQuit {
+		fmt.Fprintln(output, "Bye!")
+		return nil
+	}
+
+	return err
+}
+
+// gameSnapshot is the state of the game in the format of a scenario.
+func gameSnapshot() gameState {
+	s := gameState{
+		Version: currentVersion.Name,
+		Market:  make(map[string]int),
+	}
+	// Before the version is chosen there is no market yet.
+	if market.Market == nil {
+		return s
+	}
+	for _, cardCount := range market.EachCard() {
+		s.Market[cardCount.Card.Name] += cardCount.Count
+	}
+
+	for _, p := range plrs {
+		sp := scenarioPlayer{
+			Coins:      p.Coins.Total(),
+			Investment: p.Investment.Total(),
+			Cards:      make(map[string]int),
+			Closed:     make(map[string]int),
+		}
+		for name, pc := range p.SupplyCards {
+			if pc.Total == 0 {
+				continue
+			}
+			sp.Cards[name] = pc.Total
+			if pc.Renovation > 0 {
+				sp.Closed[name] = pc.Renovation
+			}
+		}
+		for _, landmark := range market.LandmarkCards {
+			if p.LandmarkCards[landmark.Name] {
+				sp.Landmarks = append(sp.Landmarks, landmark.Name)
+			}
+		}
+		s.Players = append(s.Players, sp)
+	}
+
+	return s
+}
@@ -1,7 +1,43 @@
 package main
 
+// landmarkCard is a landmark that players build to win. In Machi Koro 2 the
+// cost depends on how many landmarks the player has already built (Costs),
+// and the ability of a built landmark applies to all players (Global). Some
+// landmarks can only be built when a prerequisite is met (Prereq), and some
+// win the game as soon as they are built (WinsGame) or are not needed to win
+// (Optional). The ability of the landmark hooks into the turn through its
+// Effect.
 type landmarkCard struct {
 	Name        string
 	Cost        int
+	Costs       []int
+	Global      bool
+	WinsGame    bool
+	Optional    bool
+	Prereq      prereq
+	Effect      landmarkEffect
 	Description string
 }
+
+// CanBuild checks the prerequisite of the landmark for the player.
+func (l landmarkCard) CanBuild(p *player) bool {
+	if l.Prereq.Call == nil {
+		return true
+	}
+
+	return l.Prereq.Call(supplyCard{Name: l.Name}, p, p, 1, nil, 0)
+}
+
+// CostFor is what the landmark costs the player to build.
+func (l landmarkCard) CostFor(p *player) int {
+	if len(l.Costs) == 0 {
+		return l.Cost
+	}
+
+	built := landmarkCount(p)
+	if built >= len(l.Costs) {
+		built = len(l.Costs) - 1
+	}
+
+	return l.Costs[built]
+}
@@ -0,0 +1,104 @@
+package main
+
+import "fmt"
+
+// landmarkEffect is the ability of a landmark. Each hook is called at its
+// point in the turn of a player the landmark applies to, and hooks that are
+// not set are skipped. Like establishment effects, hooks are called in
+// priority order.
+type landmarkEffect struct {
+	Priority int
+
+	BeforeRoll  func(landmark landmarkCard, t *turn)
+	AfterRoll   func(landmark landmarkCard, t *turn)
+	Payout      func(landmark landmarkCard, payout int, card supplyCard, p *player) int
+	BeforeBuild func(landmark landmarkCard, t *turn)
+	AfterBuild  func(landmark landmarkCard, t *turn)
+	EndOfTurn   func(landmark landmarkCard, t *turn)
+}
+
+type turnEvent int
+
+const (
+	beforeRollEvent turnEvent = iota
+	afterRollEvent
+	beforeBuildEvent
+	afterBuildEvent
+	endOfTurnEvent
+)
+
+// Hook returns the hook for a turn event, which is nil when the landmark
+// doesn't hook into the event.
+func (e landmarkEffect) Hook(event turnEvent) func(landmark landmarkCard, t *turn) {
+	switch event {
+	case beforeRollEvent:
+		return e.BeforeRoll
+	case afterRollEvent:
+		return e.AfterRoll
+	case beforeBuildEvent:
+		return e.BeforeBuild
+	case afterBuildEvent:
+		return e.AfterBuild
+	case endOfTurnEvent:
+		return e.EndOfTurn
+	}
+
+	return nil
+}
+
+// appliedLandmarks lists the landmarks whose ability applies to the player,
+// in priority order.
+func appliedLandmarks(p *player) []landmarkCard {
+	var applied []landmarkCard
+
+	for i := 0; i < 3; i++ {
+		for _, landmark := range market.LandmarkCards {
+			if landmark.Effect.Priority == i && p.HasLandmark(landmark.Name) {
+				applied = append(applied, landmark)
+			}
+		}
+	}
+
+	return applied
+}
+
+func landmarkCardAgumentedPayout(payout int, card supplyCard, p *player) int {
+	for _, landmark := range appliedLandmarks(p) {
+		if landmark.Effect.Payout != nil {
+			payout = landmark.Effect.Payout(landmark, payout, card, p)
+		}
+	}
+
+	return payout
+}
+
+func newIconPayoutBonus(bonus int, icons ...cardIcon) landmarkEffect {
+	return landmarkEffect{
+		Payout: func(landmark landmarkCard, payout int, card supplyCard, p *player) int {
+			for _, icon := range icons {
+				if card.Icon == icon {
+					return payout + bonus
+				}
+			}
+			return payout
+		},
+	}
+}
+
+// newBankLandmarkPayout pays the roller from the bank at the given point in
+// the turn, when the condition is met.
+func newBankLandmarkPayout(payout int, reason string, cond func(t *turn) bool) func(landmark landmarkCard, t *turn) {
+	return func(landmark landmarkCard, t *turn) {
+		if !cond(t) {
+			return
+		}
+
+		fmt.Fprintf(output, "Getting %d coins from the bank, since %s [%s]\n", payout, reason, landmark.Name)
+
+		remainder := bank.TransferTo(payout, &t.Roller.Coins)
+
+		if remainder > 0 {
+			fmt.Fprintf(output, "Bank did not have enough money. Missing: %d\n", remainder)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// lintProblem is a problem found in the card data. Errors are data that is
+// certainly wrong, warnings are data that is only suspicious.
+type lintProblem struct {
+	Scope   string
+	Card    string
+	Message string
+	Warning bool
+}
+
+func (l lintProblem) String() string {
+	level := "error"
+	if l.Warning {
+		level = "warning"
+	}
+
+	return fmt.Sprintf("%s: %s: %s: %s", level, l.Scope, l.Card, l.Message)
+}
+
+// maxDiceRoll is the highest roll with 2 of the dice in use, and
+// maxHarborRoll the highest roll when the Harbor adds 2 to it.
+func maxDiceRoll() int {
+	return 2 * diceFaces(gameDice)
+}
+
+func maxHarborRoll() int {
+	return maxDiceRoll() + 2
+}
+
+var descriptionReference = regexp.MustCompile(`\[([^\]]+)\]`)
+
+// priorityForColor is the priority an effect must have so that it activates
+// in the order of the rules: red first, then blue and green, then purple.
+func priorityForColor(color cardColor) int {
+	switch color {
+	case redColor:
+		return 0
+	case purpleColor:
+		return 2
+	}
+
+	return 1
+}
+
+// turnPhraseForColor is the phrase that every description of a card of the
+// color has to contain.
+func turnPhraseForColor(color cardColor) string {
+	switch color {
+	case blueColor:
+		return "anyone's turn"
+	case redColor:
+		return "the player who rolled the dice"
+	}
+
+	return "your turn only"
+}
+
+// describe calls the description of the effect, which may panic for broken
+// card data.
+func describe(card *supplyCard) (desc string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	if card.Effect.Description == nil {
+		return "", fmt.Errorf("Effect has no description")
+	}
+
+	return card.Effect.Description(), nil
+}
+
+func containsAmount(desc string, amount int) bool {
+	return regexp.MustCompile(`\b` + strconv.Itoa(amount) + `\b`).MatchString(desc)
+}
+
+// lintCards checks the cards, with landmarks being the landmarks that their
+// effects can reference and maxRoll the highest roll they can activate on.
+func lintCards(scope string, cards []*supplyCard, landmarks []landmarkCard, maxRoll int) []lintProblem {
+	var problems []lintProblem
+
+	report := func(card string, warning bool, format string, a ...interface{}) {
+		problems = append(problems, lintProblem{
+			Scope:   scope,
+			Card:    card,
+			Message: fmt.Sprintf(format, a...),
+			Warning: warning,
+		})
+	}
+
+	names := make(map[string]bool)
+	icons := make(map[cardIcon]bool)
+	for _, card := range cards {
+		icons[card.Icon] = true
+	}
+	landmarkNames := make(map[string]bool)
+	for _, landmark := range landmarks {
+		landmarkNames[landmark.Name] = true
+	}
+
+	for _, card := range cards {
+		if card.Name == "" {
+			report("(no name)", false, "Card has no name")
+		}
+		if names[card.Name] {
+			report(card.Name, false, "Card name is used more than once")
+		}
+		names[card.Name] = true
+	}
+
+	for _, card := range cards {
+		if card.Supply <= 0 {
+			report(card.Name, false, "Card has no supply")
+		}
+		if !card.Icon.Valid() {
+			report(card.Name, false, "Card has an unknown icon")
+		}
+		if !card.Color.Valid() {
+			report(card.Name, false, "Card has an unknown color")
+		}
+
+		if len(card.ActiveNumbers) == 0 {
+			report(card.Name, false, "Card has no active numbers")
+		}
+		for _, number := range card.ActiveNumbers {
+			if number < 1 || number > maxHarborRoll() {
+				report(card.Name, false, "Active number %d can never be rolled", number)
+			} else if number > maxRoll {
+				report(card.Name, true, "Active number %d can only be rolled with the Harbor", number)
+			}
+		}
+
+		if card.Effect.Call == nil {
+			report(card.Name, false, "Effect does nothing")
+		}
+		if card.Color.Valid() && card.Effect.Priority != priorityForColor(card.Color) {
+			report(card.Name, false, "Effect priority %d does not match the color %s", card.Effect.Priority, card.Color)
+		}
+
+		refs := card.Effect.References
+		for _, name := range refs.Cards {
+			if !names[name] {
+				report(card.Name, false, "Effect references unknown card '%s'", name)
+			}
+		}
+		for _, name := range refs.Landmarks {
+			if !landmarkNames[name] {
+				report(card.Name, false, "Effect references unknown landmark '%s'", name)
+			}
+		}
+		for _, icon := range refs.Icons {
+			if !icon.Valid() {
+				report(card.Name, false, "Effect references an unknown icon")
+			} else if !icons[icon] {
+				report(card.Name, true, "Effect references [%s], but no card has that icon", icon)
+			}
+		}
+
+		desc, err := describe(card)
+		if err != nil {
+			report(card.Name, false, "Description failed: %s", err)
+			continue
+		}
+		for _, amount := range refs.Amounts {
+			if !containsAmount(desc, amount) {
+				report(card.Name, false, "Description does not mention the amount %d", amount)
+			}
+		}
+		for _, match := range descriptionReference.FindAllStringSubmatch(desc, -1) {
+			name := match[1]
+			if _, err := parseCardIcon(name); err == nil {
+				continue
+			}
+			if !names[name] && !landmarkNames[name] {
+				report(card.Name, true, "Description references unknown '%s'", name)
+			}
+		}
+		if phrase := turnPhraseForColor(card.Color); card.Color.Valid() && !strings.Contains(desc, phrase) {
+			report(card.Name, true, "Description of a %s card does not say \"%s\"", card.Color, phrase)
+		}
+	}
+
+	return problems
+}
+
+// lintCardSet checks a card set on its own, so references to cards of other
+// card sets are not checked.
+func lintCardSet(set cardSet) []lintProblem {
+	var problems []lintProblem
+
+	landmarks := append(append([]landmarkCard{}, allLandmarkCards...), machiKoro2LandmarkCards...)
+	for _, problem := range lintCards(set.Name, set.Cards, landmarks, maxHarborRoll()) {
+		if strings.HasPrefix(problem.Message, "Effect references unknown card") {
+			continue
+		}
+		problems = append(problems, problem)
+	}
+
+	return problems
+}
+
+// lintGameVersion sets up the version like a game would and checks its
+// market. The globals that the version initializes are restored afterwards.
+func lintGameVersion(version gameVersion) (problems []lintProblem) {
+	restore := saveGlobals()
+	defer func() {
+		if r := recover(); r != nil {
+			problems = append(problems, lintProblem{
+				Scope:   version.Name,
+				Card:    "(version)",
+				Message: fmt.Sprintf("Version could not be set up: %v", r),
+			})
+		}
+		restore()
+	}()
+
+	if err := version.Init(); err != nil {
+		return []lintProblem{{
+			Scope:   version.Name,
+			Card:    "(version)",
+			Message: fmt.Sprintf("Version could not be set up: %s", err),
+		}}
+	}
+	versionMarket := market
+	versionStartingCards := startingSupplyCards
+
+	// Setting up the market takes cards from the supply, the lint has to see
+	// the supply of the card data.
+	restore()
+
+	maxRoll := maxDiceRoll()
+	if _, ok := versionMarket.FindLandmark("Harbor"); ok {
+		maxRoll = maxHarborRoll()
+	}
+
+	problems = lintCards(version.Name, versionMarket.Cards, versionMarket.LandmarkCards, maxRoll)
+
+	for _, name := range versionStartingCards {
+		if _, ok := findByName(versionMarket.Cards, name); !ok {
+			problems = append(problems, lintProblem{
+				Scope:   version.Name,
+				Card:    name,
+				Message: "Starting card is not in the version",
+			})
+		}
+	}
+
+	return problems
+}
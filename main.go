@@ -2,215 +2,150 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
-	"math/rand"
 	"os"
-	"strconv"
 	"strings"
 )
 
 func main() {
-	fmt.Println("machi koro!")
-
-	fmt.Print("How many players (2 - 4): ")
-	plrCount, err := scanInt([]int{2, 3, 4})
-
+	var bots botFlags
+	protocolName := flag.String("protocol", textProtocol, "The protocol of the game, text or jsonl")
+	flag.Var(&bots, "bot", "A bot for a seat, like 1=./mybot (can be repeated)")
+	botTimeout := flag.Duration("bot-timeout", defaultBotTimeout, "How long a bot can take for a decision")
+	diceSpec := flag.String("dice", "d6", "The dice, like d6, d8 or weighted=1,1,1,1,1,2")
+	diceSeed := flag.Int64("dice-seed", 0, "Roll the dice from this seed, the same in every game")
+	names := flag.String("names", "", "The profiles of the seats for the match history, like alice,bob")
+	flag.Parse()
+
+	dice, err := parseDice(*diceSpec)
 	if err != nil {
-		fmt.Println("This game is for 2-4 players")
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	if *diceSeed != 0 {
+		dice = seededDice(dice, *diceSeed)
+	}
+	gameDice = dice
+	currentMatch = matchSetup{Names: parseNames(*names), Bots: bots, Dice: *diceSpec, DiceSeed: *diceSeed}
 
-	version, err := promptVersionChoice()
+	if runCommand(flag.Args()) {
+		return
+	}
 
-	if err != nil {
-		fmt.Println(err)
+	var protocol *jsonlProtocolIO
+	switch *protocolName {
+	case textProtocol:
+	case jsonlProtocol:
+		protocol = startJSONLProtocol()
+	default:
+		fmt.Fprintf(output, "Unknown protocol '%s'\n", *protocolName)
 		os.Exit(1)
 	}
-	version.Init()
 
-	for i := 0; i < plrCount; i++ {
-		p := player{ID: i}
-		plrs = append(plrs, &p)
-		remainder := bank.TransferTo(3, &p.Coins)
-
-		if remainder > 0 {
-			fmt.Printf("Bank did not have enough money. Missing: %d\n", remainder)
-		}
-		p.SupplyCards = make(map[string]*playerCard)
-		p.SupplyCards["Wheat Field"] = &playerCard{Total: 1, Renovation: 0}
-		p.SupplyCards["Bakery"] = &playerCard{Total: 1, Renovation: 0}
-
-		p.LandmarkCards = make(map[string]bool)
-		for _, landmark := range landmarkCardsSorted {
-			p.LandmarkCards[landmark.Name] = landmark.Cost == 0
-		}
+	seats, err := startBots(bots, *botTimeout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	turn := 0
-	reroll := false
-
-	// Game Loop
-	for {
-		didAction := false
-		rlr := plrs[turn]
+	mode := ""
+	if protocol != nil {
+		mode = protocolMode
+	}
+	err = playMatch(mode)
+	seats.Close()
 
-		fmt.Printf("It's player %d's turn\n", rlr.ID)
+	if protocol != nil {
+		protocol.end(err)
+		return
+	}
 
-		dieCount, err := promptDieCount(rlr.LandmarkCards["Train Station"] /* choice */)
-		if err != nil {
-			fmt.Println(err)
-			continue
-		}
-		r, doubles := roll(dieCount)
-		fmt.Printf("Player %d rolls %d\n", rlr.ID, r)
-
-		if reroll {
-			reroll = false
-		} else if rlr.LandmarkCards["Radio Tower"] {
-			fmt.Print("Do you want to re-roll? ")
-
-			if res := promptBool(); res {
-				reroll = true
-				continue
-			}
-		}
+	if err == errGameQuit {
+		fmt.Fprintln(output, "Bye!")
+	} else if err != nil {
+		fmt.Fprintln(output, err)
+		os.Exit(1)
+	}
+}
 
-		if r >= 10 && rlr.LandmarkCards["Harbor"] {
-			fmt.Print("Do you want to add 2 to your roll? ")
+// playGame plays a game from the choice of the version until a player wins,
+// or until the game is quit.
+func playGame() (err error) {
+	defer recoverQuit(&err)
 
-			if res := promptBool(); res {
-				r += 2
-			}
-		}
+	fmt.Fprintln(output, "machi koro!")
 
-		// Card effects should be applied in priority order, first red cards, then
-		// green/blue cards, then purple cards.
-		cards := market.FindByRoll(r)
-		// This two dice roll is used for some card effects to determine payouts.  It
-		// should only be rolled once per roll.
-		specialRoll := (rand.Intn(11) + 1)
-		for i := 0; i < len(plrs); i++ {
-			p := plrs[(len(plrs)+rlr.ID-i)%len(plrs)]
-
-			for _, card := range cards {
-				pc, ok := p.SupplyCards[card.Name]
-				if !ok {
-					continue
-				}
-				c := pc.Active()
-				pc.Renovation = 0
-				if c > 0 {
-					card.Effect.Call(*card, rlr, p, c, pc, specialRoll)
-				}
-			}
-		}
+	fmt.Fprint(output, "How many players (2 - 4): ")
+	plrCount, err := scanInt([]int{2, 3, 4})
 
-		if doubles && rlr.LandmarkCards["Amusement Park"] {
-			fmt.Print("You got doubles, do you want to roll again? ")
+	if err != nil {
+		return errors.New("This game is for 2-4 players")
+	}
 
-			if res := promptBool(); res {
-				continue
-			}
-		}
+	version, err := promptVersionChoice()
 
-		if rlr.Coins.Total() == 0 && rlr.LandmarkCards["City Hall"] {
-			fmt.Println("Getting 1 coin from the bank, since you didn't have any")
+	if err != nil {
+		return err
+	}
+	if err = version.Init(); err != nil {
+		return err
+	}
+	currentVersion = version
 
-			remainder := bank.TransferTo(1, &rlr.Coins)
+	for i := 0; i < plrCount; i++ {
+		plrs = append(plrs, newPlayer(i, startingCoins, startingSupplyCards))
+	}
 
-			if remainder > 0 {
-				fmt.Printf("Bank did not have enough money. Missing: %d\n", remainder)
-			}
-		}
+	return playTurns(version, 0)
+}
 
-		didAction = promptSupplyCardPurchase(rlr)
-		if didAction {
-			didAction = false
-		} else {
-			didAction = promptLandmarkCardPurchase(rlr)
+// recoverQuit stops the panic of a player quitting the game, and returns
+// errGameQuit instead.
+func recoverQuit(err *error) {
+	if r := recover(); r != nil {
+		if _, ok := r.(gameQuit); !ok {
+			panic(r)
 		}
+		*err = errGameQuit
+	}
+}
 
-		if !didAction && rlr.LandmarkCards["Airport"] {
-			fmt.Println("Getting 10 coins from the bank, since you didn't buy anything")
-
-			remainder := bank.TransferTo(10, &rlr.Coins)
+// playTurns plays the turns of the players, starting with the current player,
+// until a player wins.
+func playTurns(version gameVersion, current int) error {
+	// Game Loop
+	for {
+		rlr := plrs[current]
+		t, won := takeTurn(version, rlr)
 
-			if remainder > 0 {
-				fmt.Printf("Bank did not have enough money. Missing: %d\n", remainder)
-			}
+		if won {
+			fmt.Fprintf(output, "Player %d has won the game!\n", rlr.ID)
+			return nil
 		}
 
-		winner := true
-		for _, hasLandmark := range rlr.LandmarkCards {
-			if !hasLandmark {
-				winner = false
-				break
-			}
+		if !t.ExtraTurn {
+			current = (current + 1) % len(plrs)
 		}
-		if winner {
-			fmt.Printf("Player %d has won the game!\n", rlr.ID)
-			os.Exit(0)
-		}
-
-		pc, ok := rlr.SupplyCards["Tech Startup"]
-		if ok {
-			if pc.Total > 0 {
-				promptInvestment(rlr, pc.Total)
-			}
-		}
-
-		turn = (turn + 1) % len(plrs)
 	}
 }
 
 func promptInvestment(rlr *player, max int) {
-	fmt.Printf("How much do you want to invest into your Tech Startups (max %d) [current %d]\n", max, rlr.Investment)
+	fmt.Fprintf(output, "How much do you want to invest into your Tech Startups (max %d) [current %d]\n", max, rlr.Investment)
 	var choices []int
 	for i := 0; i < max; i++ {
 		choices = append(choices, i+1)
 	}
-	investment, err := scanInt(choices)
+	investment, err := promptOptionalChoice(choices, nil)
 	if err != nil {
-		fmt.Println("No investment made.")
+		fmt.Fprintln(output, "No investment made.")
 		return
 	}
 	rlr.Coins.TransferTo(investment, &rlr.Investment)
 }
 
-func promptBool() bool {
-	fmt.Print("(y/n) ")
-
-	var val string
-	fmt.Scan(&val)
-
-	switch val {
-	case "y", "yes":
-		return true
-	}
-	return false
-}
-
-func scanInt(oneOf []int) (int, error) {
-	var val int
-	fmt.Scan(&val)
-
-	for _, v := range oneOf {
-		if v == val {
-			return val, nil
-		}
-	}
-
-	strInts := make([]string, len(oneOf))
-	for i, v := range oneOf {
-		strInts[i] = strconv.Itoa(v)
-	}
-	values := strings.Join(strInts, ", ")
-
-	return 0, fmt.Errorf("Invalid input '%d' for values (%s)", val, values)
-}
-
 func promptSupplyCardPurchase(rlr *player) bool {
-	fmt.Printf("Do you want to buy an establishment? (%d coins) ", rlr.Coins.Total())
+	fmt.Fprintf(output, "Do you want to buy an establishment? (%d coins) ", rlr.Coins.Total())
 
 	if res := promptBool(); !res {
 		return false
@@ -219,38 +154,44 @@ func promptSupplyCardPurchase(rlr *player) bool {
 	i := 0
 	choices := []int{}
 	choiceNames := []string{}
-	fmt.Println("Establishments: ")
-	for _, cardCount := range market.EachCard() {
+	printMenu("Establishments:")
+	for _, cardCount := range market.Query().InStock().SortBy(byActiveNumber).Counts() {
 		card := cardCount.Card
 		count := cardCount.Count
-		if count == 0 {
-			continue
-		}
 		// Some cards have negative cost (i.e. get money from the bank)
 		displayCost := card.Cost
 		if displayCost < 0 {
 			displayCost = 0
 		}
 
+		var owned string
+		if pc, ok := rlr.SupplyCards[card.Name]; ok && pc.Total > 0 {
+			owned = fmt.Sprintf(" (you own %s)", pc)
+		}
+
 		i++
 		choices = append(choices, i)
 		choiceNames = append(choiceNames, card.Name)
-		fmt.Printf("  (%d) %s [%d coins] (%d left): %s\n", i, card.Name, displayCost, count, card.Effect.Description())
+		printMenu("  (%d) %s (%s, %s) [%d coins] (%d left)%s: %s", i, card.Name, card.Color, card.Icon, displayCost, count, owned, card.Effect.Description())
 	}
 
-	fmt.Print("Which establishment do you want to buy? ")
-	supplyCardIdx, err := scanInt(choices)
+	fmt.Fprint(output, "Which establishment do you want to buy? ")
+	supplyCardIdx, err := promptOptionalChoice(choices, choiceNames)
 	if err != nil {
-		fmt.Println("No establishment selected.")
+		fmt.Fprintln(output, "No establishment selected.")
 		return false
 	}
 	supplyCardName := choiceNames[supplyCardIdx-1]
-	card := market.FindByName(supplyCardName)
+	card, ok := market.FindByName(supplyCardName)
+	if !ok {
+		fmt.Fprintf(output, "%s is not on the market.\n", supplyCardName)
+		return false
+	}
 
 	if rlr.Coins.Total() < card.Cost {
-		fmt.Printf("Player %d does not have enough coins to buy %s\n", rlr.ID, supplyCardName)
+		fmt.Fprintf(output, "Player %d does not have enough coins to buy %s\n", rlr.ID, supplyCardName)
 	} else {
-		fmt.Printf("Player %d buys %s\n", rlr.ID, supplyCardName)
+		fmt.Fprintf(output, "Player %d buys %s\n", rlr.ID, supplyCardName)
 		if card.Cost > 0 {
 			rlr.Coins.TransferTo(card.Cost, &bank)
 		} else if card.Cost < 0 {
@@ -261,14 +202,14 @@ func promptSupplyCardPurchase(rlr *player) bool {
 			pc = &playerCard{}
 			rlr.SupplyCards[supplyCardName] = pc
 		}
-		pc.Total++
+		pc.Add(false)
 		market.Purchase(card.Name)
 	}
 	return true
 }
 
 func promptLandmarkCardPurchase(rlr *player) bool {
-	fmt.Printf("Do you want to buy a landmark? (%d coins) ", rlr.Coins.Total())
+	fmt.Fprintf(output, "Do you want to buy a landmark? (%d coins) ", rlr.Coins.Total())
 
 	if res := promptBool(); !res {
 		return false
@@ -277,32 +218,33 @@ func promptLandmarkCardPurchase(rlr *player) bool {
 	i := 0
 	choices := []int{}
 	choiceNames := []string{}
-	fmt.Println("Landmarks: ")
-	for _, landmark := range landmarkCardsSorted {
-		if rlr.LandmarkCards[landmark.Name] {
-			continue
-		}
-
+	printMenu("Landmarks:")
+	for _, landmark := range market.EachLandmark(rlr) {
 		i++
 		choices = append(choices, i)
 		choiceNames = append(choiceNames, landmark.Name)
-		fmt.Printf("  (%d) %s [%d coins]: %s\n", i, landmark.Name, landmark.Cost, landmark.Description)
+		printMenu("  (%d) %s [%d coins]: %s%s", i, landmark.Name, landmark.CostFor(rlr), landmark.Prereq.Desc, landmark.Description)
 	}
 
-	fmt.Print("Which landmark do you want to buy? ")
-	landmarkIdx, err := scanInt(choices)
+	fmt.Fprint(output, "Which landmark do you want to buy? ")
+	landmarkIdx, err := promptOptionalChoice(choices, choiceNames)
 	if err != nil {
-		fmt.Println("No landmark selected.")
+		fmt.Fprintln(output, "No landmark selected.")
 		return false
 	}
 	landmarkName := choiceNames[landmarkIdx-1]
-	landmark := landmarkCards[landmarkName]
-
-	if rlr.Coins.Total() < landmark.Cost {
-		fmt.Printf("Player %d does not have enough coins to buy %s\n", rlr.ID, landmarkName)
+	landmark, _ := market.FindLandmark(landmarkName)
+	cost := landmark.CostFor(rlr)
+
+	if !landmark.CanBuild(rlr) {
+		fmt.Fprintf(output, "Player %d can't build %s. %s\n", rlr.ID, landmarkName, landmark.Prereq.Desc)
+	} else if rlr.Coins.Total() < cost {
+		fmt.Fprintf(output, "Player %d does not have enough coins to buy %s\n", rlr.ID, landmarkName)
+	} else if err = market.PurchaseLandmark(landmarkName); err != nil {
+		fmt.Fprintln(output, err)
 	} else {
-		fmt.Printf("Player %d buys %s\n", rlr.ID, landmarkName)
-		rlr.Coins.TransferTo(landmark.Cost, &bank)
+		fmt.Fprintf(output, "Player %d buys %s\n", rlr.ID, landmarkName)
+		rlr.Coins.TransferTo(cost, &bank)
 		rlr.LandmarkCards[landmarkName] = true
 	}
 
@@ -311,30 +253,155 @@ func promptLandmarkCardPurchase(rlr *player) bool {
 
 func promptVersionChoice() (gameVersion, error) {
 	var choice gameVersion
+
+	presets, err := loadVersionPresets()
+	if err != nil {
+		fmt.Fprintln(output, err)
+	}
+	for _, preset := range presets {
+		registerGameVersion(preset.GameVersion())
+	}
+
 	choices := []int{}
 	choiceNames := []string{}
-	fmt.Println("Versions: ")
+	printMenu("Versions:")
 	for i, version := range gameVersionsSorted {
 		choices = append(choices, i+1)
 		choiceNames = append(choiceNames, version.Name)
-		fmt.Printf("  (%d) %s \n", i+1, version.Name)
+		printMenu("  (%d) %s", i+1, version.Name)
 	}
+	builderIdx := len(gameVersionsSorted) + 1
+	choices = append(choices, builderIdx)
+	printMenu("  (%d) Build a custom version", builderIdx)
 
-	fmt.Print("Which version do you want to play? ")
-	versionIdx, err := scanInt(choices)
+	fmt.Fprint(output, "Which version do you want to play? ")
+	versionIdx, err := promptChoice(choices, append(choiceNames, "Build a custom version"))
 	if err != nil {
 		return choice, errors.New("No version selected.")
 	}
 
+	if versionIdx == builderIdx {
+		return promptVersionBuilder()
+	}
+
 	return gameVersionsSorted[versionIdx-1], nil
 }
 
+// registerGameVersion adds a version to the choices, replacing a version with
+// the same name.
+func registerGameVersion(version gameVersion) {
+	for i, v := range gameVersionsSorted {
+		if v.Name == version.Name {
+			gameVersionsSorted[i] = version
+			return
+		}
+	}
+
+	gameVersionsSorted = append(gameVersionsSorted, version)
+}
+
+func promptVersionBuilder() (gameVersion, error) {
+	var choice gameVersion
+	config := versionConfig{Market: basicMarketLayout}
+
+	fmt.Fprint(output, "What is the name of the version? ")
+	config.Name = promptLine()
+
+	fmt.Fprintln(output, "Card sets: ")
+	for _, set := range cardSetsSorted {
+		fmt.Fprintf(output, "Include the cards from %s? ", set.Name)
+		if promptBool() {
+			config.CardSets = append(config.CardSets, set.Name)
+		}
+	}
+
+	fmt.Fprintln(output, "Landmarks: ")
+	for _, landmark := range allLandmarkCards {
+		fmt.Fprintf(output, "Include %s [%d coins]: %s? ", landmark.Name, landmark.Cost, landmark.Description)
+		if promptBool() {
+			config.Landmarks = append(config.Landmarks, landmark.Name)
+		}
+	}
+
+	printMenu("Market layouts:")
+	printMenu("  (1) All establishments are on the market")
+	printMenu("  (2) 5 establishments 1-6, 5 establishments 7+ and 2 major establishments")
+	fmt.Fprint(output, "Which market layout do you want to use? ")
+	layout, err := scanInt([]int{1, 2})
+	if err != nil {
+		return choice, errors.New("No market layout selected.")
+	}
+	if layout == 2 {
+		config.Market = expansionMarketLayout
+	}
+
+	coinChoices := []int{}
+	for i := 0; i <= 20; i++ {
+		coinChoices = append(coinChoices, i)
+	}
+	fmt.Fprint(output, "How many coins does each player start with (0 - 20)? ")
+	config.StartingCoins, err = scanInt(coinChoices)
+	if err != nil {
+		return choice, errors.New("No starting coins selected.")
+	}
+
+	fmt.Fprintf(output, "Start with %s? ", strings.Join(startingSupplyCards, " and "))
+	if promptBool() {
+		config.StartingCards = startingSupplyCards
+	} else {
+		config.StartingCards = promptStartingCards(config)
+	}
+
+	if err = config.Validate(); err != nil {
+		return choice, err
+	}
+
+	fmt.Fprint(output, "Do you want to save this version as a preset? ")
+	if promptBool() {
+		if err = saveVersionPreset(config); err != nil {
+			fmt.Fprintf(output, "Could not save the preset: %s\n", err)
+		}
+	}
+
+	choice = config.GameVersion()
+	registerGameVersion(choice)
+
+	return choice, nil
+}
+
+func promptStartingCards(config versionConfig) []string {
+	var cards []*supplyCard
+	for _, name := range config.CardSets {
+		set, _ := findCardSet(name)
+		cards = append(cards, set.Cards...)
+	}
+
+	startingCards := []string{}
+	choices := []int{0}
+	names := []string{}
+	printMenu("Establishments:")
+	for i, card := range cards {
+		choices = append(choices, i+1)
+		names = append(names, card.Name)
+		printMenu("  (%d) %s", i+1, card.Name)
+	}
+
+	for {
+		fmt.Fprint(output, "Which establishment does each player start with (0 when done)? ")
+		cardIdx, err := promptOptionalChoice(choices, append([]string{"done"}, names...))
+		if err != nil || cardIdx == 0 {
+			return startingCards
+		}
+		startingCards = append(startingCards, cards[cardIdx-1].Name)
+	}
+}
+
 func promptDieCount(choice bool) (int, error) {
 	var dieCount int
 	var err error
 
 	if choice {
-		fmt.Print("Roll 1 die or 2 dice? ")
+		fmt.Fprint(output, "Roll 1 die or 2 dice? ")
 		dieCount, err = scanInt([]int{1, 2})
 
 		if err != nil {
@@ -347,17 +414,12 @@ func promptDieCount(choice bool) (int, error) {
 	return dieCount, err
 }
 
-func roll(dieCount int) (int, bool) {
-	var doubles bool
-
-	r := 0
-	for i := 0; i < dieCount; i++ {
-		die := rand.Intn(5) + 1
-		if i == 2 && r == die {
-			doubles = true
-		}
-		r += die
-	}
+func roll(dieCount int) []int {
+	return gameDice.Roll(dieCount)
+}
 
-	return r, doubles
+// rollSpecialDice is the 2 dice roll that some effects use for their payout.
+func rollSpecialDice() int {
+	r, _ := rollWith(gameDice, 2)
+	return r
 }
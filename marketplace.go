@@ -2,20 +2,28 @@ package main
 
 import (
 	"errors"
-	"math/rand"
+	"fmt"
 )
 
 // Marketplace should manage the available and supply of cards
 // For example in harbor and millionaire's row not all cards are on the table at all times
 // In the english version it simply picks 10 cards at time. In the Czech version there are
-//   * 5 cards 1-6
-//   * 5 cards 7+
-//   * 2 cards Major establishments
-//
+//   - 5 cards 1-6
+//   - 5 cards 7+
+//   - 2 cards Major establishments
 type marketplace struct {
 	Market           marketManager
+	Landmarks        landmarkManager
 	Cards            []*supplyCard
 	PrioritizedCards []*supplyCard
+	LandmarkCards    []landmarkCard
+
+	// Indexes of the cards, so lookups during a turn don't scan all cards.
+	// Cards in iconIndex are in the order of Cards and cards in rollIndex are in
+	// priority order.
+	nameIndex map[string]*supplyCard
+	iconIndex map[cardIcon][]*supplyCard
+	rollIndex map[int][]*supplyCard
 }
 
 type cardCount struct {
@@ -28,10 +36,28 @@ type marketManager interface {
 	cards() []cardCount
 }
 
+// landmarkManager decides which landmarks can be built. In the classic game
+// every player can build every landmark, while in Machi Koro 2 landmarks are
+// bought from a shared market and each landmark can only be built once.
+type landmarkManager interface {
+	removeLandmark(string) error
+	landmarks() []landmarkCard
+}
+
 type basicMarket struct {
 	OnMarket []*supplyCard
 }
 
+type fixedLandmarks struct {
+	Cards []landmarkCard
+}
+
+type landmarkMarket struct {
+	OnMarket []landmarkCard
+	Deck     []landmarkCard
+	Max      int
+}
+
 type expansionMarket struct {
 	LOnMarket map[string]int
 	HOnMarket map[string]int
@@ -42,9 +68,15 @@ type expansionMarket struct {
 	Cards     []*supplyCard
 }
 
-func newMarketplace(cards []*supplyCard, manager marketManager) marketplace {
+func newMarketplace(cards []*supplyCard, manager marketManager, landmarks []landmarkCard, landmarkManager landmarkManager) (marketplace, error) {
 	var prioritized []*supplyCard
 
+	// Broken card data would silently pay nothing during the game, so it is
+	// better to stop when the card set is loaded.
+	if err := validateCards(cards); err != nil {
+		return marketplace{}, err
+	}
+
 	for i := 0; i < 3; i++ {
 		for _, card := range cards {
 			if card.Effect.Priority == i {
@@ -53,11 +85,30 @@ func newMarketplace(cards []*supplyCard, manager marketManager) marketplace {
 		}
 	}
 
+	nameIndex := make(map[string]*supplyCard)
+	iconIndex := make(map[cardIcon][]*supplyCard)
+	rollIndex := make(map[int][]*supplyCard)
+
+	for _, card := range cards {
+		nameIndex[card.Name] = card
+		iconIndex[card.Icon] = append(iconIndex[card.Icon], card)
+	}
+	for _, card := range prioritized {
+		for _, number := range card.ActiveNumbers {
+			rollIndex[number] = append(rollIndex[number], card)
+		}
+	}
+
 	return marketplace{
 		Market:           manager,
+		Landmarks:        landmarkManager,
 		Cards:            cards,
 		PrioritizedCards: prioritized,
-	}
+		LandmarkCards:    landmarks,
+		nameIndex:        nameIndex,
+		iconIndex:        iconIndex,
+		rollIndex:        rollIndex,
+	}, nil
 }
 
 func newBasicMarketManager(cards []*supplyCard) basicMarket {
@@ -70,11 +121,12 @@ func newExpansionMarketManager(cards []*supplyCard) expansionMarket {
 	var mcards []*supplyCard
 
 	for _, card := range cards {
-		if card.Icon == "Major" {
+		switch expansionRow(card) {
+		case majorRow:
 			mcards = append(mcards, card)
-		} else if card.ActiveNumbers[0] >= 7 {
+		case highRow:
 			hcards = append(hcards, card)
-		} else {
+		default:
 			lcards = append(lcards, card)
 		}
 	}
@@ -94,28 +146,66 @@ func newExpansionMarketManager(cards []*supplyCard) expansionMarket {
 	return manager
 }
 
-func newBasicMarketplace(cards []*supplyCard) marketplace {
-	manager := newBasicMarketManager(cards)
-	return newMarketplace(cards, manager)
+// The rows of the expansion layout.
+const (
+	lowRow = iota
+	highRow
+	majorRow
+)
+
+// expansionRow is the row of the expansion layout the card is on, 1-6, 7+ or
+// major establishments.
+func expansionRow(card *supplyCard) int {
+	if card.Icon == majorIcon {
+		return majorRow
+	}
+	if card.ActiveNumbers[0] >= 7 {
+		return highRow
+	}
+
+	return lowRow
 }
 
-func newExpansionMarketplace(cards []*supplyCard) marketplace {
-	manager := newExpansionMarketManager(cards)
-	return newMarketplace(cards, manager)
+func newLandmarkMarketManager(landmarks []landmarkCard, max int) *landmarkMarket {
+	deck := make([]landmarkCard, len(landmarks))
+	copy(deck, landmarks)
+
+	manager := &landmarkMarket{
+		Deck: deck,
+		Max:  max,
+	}
+
+	manager.resupplyMarket()
+
+	return manager
 }
 
-func (s *marketplace) FindByIcon(icon string) []*supplyCard {
-	var found []*supplyCard
+func newBasicMarketplace(cards []*supplyCard, landmarks []landmarkCard) (marketplace, error) {
+	manager := newBasicMarketManager(cards)
+	return newMarketplace(cards, manager, landmarks, fixedLandmarks{Cards: landmarks})
+}
 
-	for i := range s.Cards {
-		card := s.Cards[i]
+func newExpansionMarketplace(cards []*supplyCard, landmarks []landmarkCard) (marketplace, error) {
+	// The layout puts the cards in rows by their active numbers.
+	if err := validateCards(cards); err != nil {
+		return marketplace{}, err
+	}
+	manager := newExpansionMarketManager(cards)
+	return newMarketplace(cards, manager, landmarks, fixedLandmarks{Cards: landmarks})
+}
 
-		if card.Icon == icon {
-			found = append(found, card)
-		}
+// newMachiKoro2Marketplace uses the expansion layout for establishments, and
+// offers 5 landmarks at a time from a shared landmark market.
+func newMachiKoro2Marketplace(cards []*supplyCard, landmarks []landmarkCard) (marketplace, error) {
+	if err := validateCards(cards); err != nil {
+		return marketplace{}, err
 	}
+	manager := newExpansionMarketManager(cards)
+	return newMarketplace(cards, manager, landmarks, newLandmarkMarketManager(landmarks, 5))
+}
 
-	return found
+func (s *marketplace) FindByIcon(icon cardIcon) []*supplyCard {
+	return s.iconIndex[icon]
 }
 
 func findByName(cards []*supplyCard, name string) (*supplyCard, bool) {
@@ -128,36 +218,53 @@ func findByName(cards []*supplyCard, name string) (*supplyCard, bool) {
 	return &supplyCard{}, false
 }
 
-func (s *marketplace) FindByName(name string) *supplyCard {
-	card, _ := findByName(s.Cards, name)
-	return card
+// FindByName finds the card of the market, unknown names are not found.
+func (s *marketplace) FindByName(name string) (*supplyCard, bool) {
+	card, ok := s.nameIndex[name]
+	return card, ok
 }
 
 func (s *marketplace) FindByRoll(roll int) []*supplyCard {
-	var found []*supplyCard
-
-	for i := range s.PrioritizedCards {
-		card := s.Cards[i]
+	return s.rollIndex[roll]
+}
 
-		for _, number := range card.ActiveNumbers {
-			if number == roll {
-				found = append(found, card)
-				break
-			}
+func (s *marketplace) FindLandmark(name string) (landmarkCard, bool) {
+	for _, landmark := range s.LandmarkCards {
+		if landmark.Name == name {
+			return landmark, true
 		}
 	}
 
-	return found
+	return landmarkCard{}, false
 }
 
 func (s *marketplace) EachCard() []cardCount {
 	return s.Market.cards()
 }
 
+// EachLandmark lists the landmarks that the player can build right now.
+func (s *marketplace) EachLandmark(p *player) []landmarkCard {
+	var landmarks []landmarkCard
+
+	for _, landmark := range s.Landmarks.landmarks() {
+		if p.LandmarkCards[landmark.Name] {
+			continue
+		}
+
+		landmarks = append(landmarks, landmark)
+	}
+
+	return landmarks
+}
+
 func (s *marketplace) Purchase(name string) error {
 	return s.Market.remove(name)
 }
 
+func (s *marketplace) PurchaseLandmark(name string) error {
+	return s.Landmarks.removeLandmark(name)
+}
+
 func (m basicMarket) remove(name string) error {
 	card, _ := findByName(m.OnMarket, name)
 
@@ -227,10 +334,19 @@ func (m expansionMarket) cards() []cardCount {
 }
 
 func takeCard(cards []*supplyCard) (*supplyCard, int) {
-	idx := rand.Intn(len(cards)-1) + 1
+	var names []string
+	for _, card := range cards {
+		names = append(names, card.Name)
+	}
+	idx := drawFrom(names)
 	return cards[idx], idx
 }
 
+// drawRandom draws one of the cards of a deck at random.
+func drawRandom(names []string) int {
+	return drawIndex(len(names))
+}
+
 func removePart(count map[string]int, name string) (map[string]int, bool, bool) {
 	var deleted bool
 
@@ -273,3 +389,157 @@ func (m expansionMarket) resupplyMarket() {
 	m.HOnMarket, m.HCards = resupplyPart(m.HOnMarket, m.HCards, 5)
 	m.MOnMarket, m.MCards = resupplyPart(m.MOnMarket, m.MCards, 2)
 }
+
+func (m fixedLandmarks) removeLandmark(name string) error {
+	for _, landmark := range m.Cards {
+		if landmark.Name == name {
+			return nil
+		}
+	}
+
+	return errors.New("Can't build landmark, it is not part of this game")
+}
+
+func (m fixedLandmarks) landmarks() []landmarkCard {
+	return m.Cards
+}
+
+func (m *landmarkMarket) removeLandmark(name string) error {
+	for i, landmark := range m.OnMarket {
+		if landmark.Name != name {
+			continue
+		}
+
+		m.OnMarket = append(m.OnMarket[:i:i], m.OnMarket[i+1:]...)
+		m.resupplyMarket()
+
+		return nil
+	}
+
+	return errors.New("Can't build landmark, it is not on the market place")
+}
+
+func (m *landmarkMarket) landmarks() []landmarkCard {
+	return m.OnMarket
+}
+
+func (m *landmarkMarket) resupplyMarket() {
+	for len(m.OnMarket) < m.Max && len(m.Deck) > 0 {
+		var names []string
+		for _, landmark := range m.Deck {
+			names = append(names, landmark.Name)
+		}
+		idx := drawFrom(names)
+		m.OnMarket = append(m.OnMarket, m.Deck[idx])
+		m.Deck = append(m.Deck[:idx:idx], m.Deck[idx+1:]...)
+	}
+}
+
+// marketLayout is what a saved game needs besides the cards on the market to
+// set the market up again: the layout, the cards left in the deck of the
+// expansion layout and the landmark market of Machi Koro 2.
+type marketLayout struct {
+	Layout       string         `json:"layout"`
+	Deck         map[string]int `json:"deck,omitempty"`
+	Landmarks    []string       `json:"landmarks,omitempty"`
+	LandmarkDeck []string       `json:"landmark_deck,omitempty"`
+}
+
+func (s *marketplace) saveLayout() marketLayout {
+	var l marketLayout
+
+	switch m := s.Market.(type) {
+	case basicMarket:
+		l.Layout = basicMarketLayout
+	case expansionMarket:
+		l.Layout = expansionMarketLayout
+		l.Deck = make(map[string]int)
+		for _, card := range m.Cards {
+			if card.Supply > 0 {
+				l.Deck[card.Name] = card.Supply
+			}
+		}
+	}
+
+	if m, ok := s.Landmarks.(*landmarkMarket); ok {
+		l.Landmarks = landmarkNames(m.OnMarket)
+		l.LandmarkDeck = landmarkNames(m.Deck)
+	}
+
+	return l
+}
+
+// restoreLayout puts the market back the way it was saved, with the cards on
+// the market and the layout.
+func (s *marketplace) restoreLayout(onMarket map[string]int, l marketLayout) error {
+	for name := range onMarket {
+		if _, ok := s.nameIndex[name]; !ok {
+			return fmt.Errorf("The saved market has unknown card '%s'", name)
+		}
+	}
+	for name := range l.Deck {
+		if _, ok := s.nameIndex[name]; !ok {
+			return fmt.Errorf("The saved deck has unknown card '%s'", name)
+		}
+	}
+
+	switch m := s.Market.(type) {
+	case basicMarket:
+		// Games saved before the layout was saved have the basic layout.
+		if l.Layout != basicMarketLayout && l.Layout != "" {
+			return fmt.Errorf("The game was saved with the %s layout, the version has the %s layout", l.Layout, basicMarketLayout)
+		}
+		for _, card := range m.OnMarket {
+			card.Supply = onMarket[card.Name]
+		}
+	case expansionMarket:
+		if l.Layout != expansionMarketLayout {
+			return fmt.Errorf("The game was saved with the %s layout, the version has the %s layout", l.Layout, expansionMarketLayout)
+		}
+		restored := expansionMarket{
+			LOnMarket: make(map[string]int),
+			HOnMarket: make(map[string]int),
+			MOnMarket: make(map[string]int),
+			Cards:     m.Cards,
+		}
+		onMarketRows := map[int]map[string]int{lowRow: restored.LOnMarket, highRow: restored.HOnMarket, majorRow: restored.MOnMarket}
+		deckRows := map[int]*[]*supplyCard{lowRow: &restored.LCards, highRow: &restored.HCards, majorRow: &restored.MCards}
+		for _, card := range m.Cards {
+			row := expansionRow(card)
+			if count := onMarket[card.Name]; count > 0 {
+				onMarketRows[row][card.Name] = count
+			}
+			card.Supply = l.Deck[card.Name]
+			if card.Supply > 0 {
+				*deckRows[row] = append(*deckRows[row], card)
+			}
+		}
+		s.Market = restored
+	}
+
+	if m, ok := s.Landmarks.(*landmarkMarket); ok {
+		var err error
+		if m.OnMarket, err = s.findLandmarks(l.Landmarks); err != nil {
+			return err
+		}
+		if m.Deck, err = s.findLandmarks(l.LandmarkDeck); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *marketplace) findLandmarks(names []string) ([]landmarkCard, error) {
+	var landmarks []landmarkCard
+
+	for _, name := range names {
+		landmark, ok := s.FindLandmark(name)
+		if !ok {
+			return nil, fmt.Errorf("The saved landmark market has unknown landmark '%s'", name)
+		}
+		landmarks = append(landmarks, landmark)
+	}
+
+	return landmarks, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func marketCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, cardCount := range market.EachCard() {
+		counts[cardCount.Card.Name] += cardCount.Count
+	}
+
+	return counts
+}
+
+func TestRestoreLayout(t *testing.T) {
+	for _, version := range gameVersionsSorted {
+		restore := saveGlobals()
+
+		if err := version.Init(); err != nil {
+			t.Fatalf("%s: %s", version.Name, err)
+		}
+		for _, cardCount := range market.EachCard()[:2] {
+			market.Purchase(cardCount.Card.Name)
+		}
+		if landmarks := market.Landmarks.landmarks(); len(landmarks) > 0 {
+			market.PurchaseLandmark(landmarks[0].Name)
+		}
+
+		onMarket := marketCounts()
+		layout := market.saveLayout()
+		landmarks := landmarkNames(market.Landmarks.landmarks())
+		restore()
+
+		if err := version.Init(); err != nil {
+			t.Fatalf("%s: %s", version.Name, err)
+		}
+		if err := market.restoreLayout(onMarket, layout); err != nil {
+			t.Errorf("%s: the layout was not restored: %s", version.Name, err)
+		}
+		if got := marketCounts(); !reflect.DeepEqual(got, onMarket) {
+			t.Errorf("%s: the market is %v, want %v", version.Name, got, onMarket)
+		}
+		if got := market.saveLayout(); !reflect.DeepEqual(got, layout) {
+			t.Errorf("%s: the layout is %v, want %v", version.Name, got, layout)
+		}
+		if got := landmarkNames(market.Landmarks.landmarks()); !reflect.DeepEqual(got, landmarks) {
+			t.Errorf("%s: the landmarks are %v, want %v", version.Name, got, landmarks)
+		}
+
+		restore()
+	}
+}
+
+func TestMarketplaceValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		card *supplyCard
+	}{
+		{name: "no active numbers", card: &supplyCard{Name: "Empty", Icon: wheatIcon, Color: blueColor, Supply: 1}},
+		{name: "unknown icon", card: &supplyCard{Name: "Iconless", ActiveNumbers: []int{1}, Color: blueColor, Supply: 1}},
+		{name: "unknown color", card: &supplyCard{Name: "Colorless", ActiveNumbers: []int{1}, Icon: wheatIcon, Supply: 1}},
+	}
+
+	for _, test := range tests {
+		cards := []*supplyCard{test.card}
+		if _, err := newBasicMarketplace(cards, nil); err == nil {
+			t.Errorf("%s: the basic marketplace has no error", test.name)
+		}
+		if _, err := newExpansionMarketplace(cards, nil); err == nil {
+			t.Errorf("%s: the expansion marketplace has no error", test.name)
+		}
+		if _, err := newMachiKoro2Marketplace(cards, nil); err == nil {
+			t.Errorf("%s: the Machi Koro 2 marketplace has no error", test.name)
+		}
+	}
+}
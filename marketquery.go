@@ -0,0 +1,141 @@
+package main
+
+import "sort"
+
+// marketQuery filters and sorts the cards of a marketplace. Filters are
+// combined, so a card has to pass all of them. Results keep the order of the
+// card data unless the query is sorted, and sorting is stable.
+//
+//	market.Query().Color(greenColor).InStock().AffordableBy(rlr).SortBy(byCost).Counts()
+type marketQuery struct {
+	market  *marketplace
+	filters []func(cardCount) bool
+	less    []func(a *supplyCard, b *supplyCard) bool
+}
+
+func (s *marketplace) Query() *marketQuery {
+	return &marketQuery{market: s}
+}
+
+func (q *marketQuery) where(filter func(cardCount) bool) *marketQuery {
+	q.filters = append(q.filters, filter)
+	return q
+}
+
+func (q *marketQuery) Icon(icons ...cardIcon) *marketQuery {
+	return q.where(func(cc cardCount) bool {
+		for _, icon := range icons {
+			if cc.Card.Icon == icon {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (q *marketQuery) Color(colors ...cardColor) *marketQuery {
+	return q.where(func(cc cardCount) bool {
+		for _, color := range colors {
+			if cc.Card.Color == color {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (q *marketQuery) CostBetween(min int, max int) *marketQuery {
+	return q.where(func(cc cardCount) bool {
+		return cc.Card.Cost >= min && cc.Card.Cost <= max
+	})
+}
+
+func (q *marketQuery) ActiveOn(number int) *marketQuery {
+	return q.where(func(cc cardCount) bool {
+		for _, n := range cc.Card.ActiveNumbers {
+			if n == number {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// InStock only keeps cards that can be bought on the market right now.
+func (q *marketQuery) InStock() *marketQuery {
+	return q.where(func(cc cardCount) bool {
+		return cc.Count > 0
+	})
+}
+
+func (q *marketQuery) AffordableBy(p *player) *marketQuery {
+	return q.where(func(cc cardCount) bool {
+		return cc.Card.Cost <= p.Coins.Total()
+	})
+}
+
+// SortBy sorts the results, later orderings break ties of earlier ones.
+func (q *marketQuery) SortBy(less ...func(a *supplyCard, b *supplyCard) bool) *marketQuery {
+	q.less = append(q.less, less...)
+	return q
+}
+
+func byCost(a *supplyCard, b *supplyCard) bool {
+	return a.Cost < b.Cost
+}
+
+func byActiveNumber(a *supplyCard, b *supplyCard) bool {
+	return a.ActiveNumbers[0] < b.ActiveNumbers[0]
+}
+
+func byName(a *supplyCard, b *supplyCard) bool {
+	return a.Name < b.Name
+}
+
+// Counts returns the matching cards, with how many are on the market.
+func (q *marketQuery) Counts() []cardCount {
+	onMarket := make(map[string]int)
+	for _, cc := range q.market.EachCard() {
+		onMarket[cc.Card.Name] += cc.Count
+	}
+
+	var found []cardCount
+	for _, card := range q.market.Cards {
+		cc := cardCount{Count: onMarket[card.Name], Card: card}
+
+		matches := true
+		for _, filter := range q.filters {
+			if !filter(cc) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			found = append(found, cc)
+		}
+	}
+
+	sort.SliceStable(found, func(i int, j int) bool {
+		for _, less := range q.less {
+			if less(found[i].Card, found[j].Card) {
+				return true
+			}
+			if less(found[j].Card, found[i].Card) {
+				return false
+			}
+		}
+		return false
+	})
+
+	return found
+}
+
+func (q *marketQuery) Cards() []*supplyCard {
+	var cards []*supplyCard
+
+	for _, cc := range q.Counts() {
+		cards = append(cards, cc.Card)
+	}
+
+	return cards
+}
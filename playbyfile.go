@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	mathrand "math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A play-by-file game lives in a single file with the seed of the dice and
+// the answers of every move, a move being the decisions a player makes before
+// another player has to decide. Running the game on the file replays the
+// moves, shows what happened since the player's last move, takes the
+// decisions of the player whose turn it is and writes the file back.
+//
+// Every move carries the hash of the state before it, chained to the hash of
+// the move before, and the file the hash of the state after the last move, so
+// that edited or reordered moves are detected by the replay.
+//
+// With --commit-reveal the file has no seed, the dice are commit-reveal dice
+// and the file keeps their transcript. Each player then runs the game with
+// their --seat, and keeps the secret of their dice in a file of their own.
+// The game stops whenever a player still has to commit to or reveal their
+// dice, and that player runs it next.
+
+type playByFile struct {
+	Seed  int64     `json:"seed,omitempty"`
+	Moves []pbfMove `json:"moves"`
+	// Hash is the hash of the state after the last move.
+	Hash string `json:"hash"`
+	// Next is the player who makes the next move, for the players reading
+	// the file.
+	Next   int    `json:"next"`
+	Result string `json:"result,omitempty"`
+	// Players is the number of players of a game with commit-reveal dice,
+	// which need everyone's commitment before the market is set up.
+	Players int               `json:"players,omitempty"`
+	Dice    *commitRevealDice `json:"dice,omitempty"`
+
+	path string
+	// seat is the player running the game, or noSeat until the first
+	// decision of a game without commit-reveal dice.
+	seat       int
+	secretPath string
+	// move and answer are the next answer to replay.
+	move, answer int
+	replayed     bool
+	log          bytes.Buffer
+	offsets      []int
+	live         *pbfMove
+}
+
+// noSeat is the seat of a player who is not known yet.
+const noSeat = -2
+
+// pbfMove is the answers of a player. Choices are recorded by their labels,
+// yes or no questions as y or n, so that the replay doesn't depend on the
+// order the choices are listed in.
+type pbfMove struct {
+	Seat    int      `json:"seat"`
+	Prior   string   `json:"prior"`
+	Answers []string `json:"answers"`
+}
+
+// pbfMoveDone stops the game when the move is over.
+type pbfMoveDone struct{}
+
+// pbfError stops the game when the file can't be replayed.
+type pbfError struct {
+	err error
+}
+
+func loadPlayByFile(path string) (*playByFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		var seed [8]byte
+		if _, err = rand.Read(seed[:]); err != nil {
+			return nil, err
+		}
+		return &playByFile{Seed: int64(binary.LittleEndian.Uint64(seed[:])), path: path, seat: noSeat}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f := &playByFile{path: path, seat: noSeat}
+	if err = json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("Invalid game file %s: %s", path, err)
+	}
+	if f.Dice != nil {
+		if len(f.Dice.Commitments) != f.Players {
+			return nil, fmt.Errorf("Invalid game file %s: %d commitments for %d players", path, len(f.Dice.Commitments), f.Players)
+		}
+		if err = f.Dice.verify(); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func (f *playByFile) save() error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := f.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, f.path)
+}
+
+// stateHash is the hash of the state of the game, chained to the hash before
+// it.
+func stateHash(prior string) string {
+	state, _ := json.Marshal(gameSnapshot())
+	sum := sha256.Sum256([]byte(prior + "\n" + string(state)))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// lastHash is the hash the next move is chained to.
+func (f *playByFile) lastHash() string {
+	return f.hashBefore(len(f.Moves))
+}
+
+func (f *playByFile) hashBefore(move int) string {
+	if move == 0 {
+		return strconv.FormatInt(f.Seed, 10)
+	}
+
+	return f.Moves[move-1].Prior
+}
+
+// decide answers from the moves in the file, and from the player once they
+// are replayed. The move of the player ends when another player has to decide.
+func (f *playByFile) decide(req decisionRequest) string {
+	seat := decisionSeat()
+
+	if !f.replayed && f.move < len(f.Moves) {
+		m := f.Moves[f.move]
+		if f.answer == 0 {
+			f.offsets = append(f.offsets, f.log.Len())
+			if m.Seat != seat {
+				panic(pbfError{fmt.Errorf("Move %d is by player %d, but player %d has to decide", f.move+1, m.Seat, seat)})
+			}
+			if stateHash(f.hashBefore(f.move)) != m.Prior {
+				panic(pbfError{fmt.Errorf("The state before move %d does not match its hash, the file was changed", f.move+1)})
+			}
+		}
+
+		answer := replayAnswer(req, m.Answers[f.answer])
+		f.answer++
+		if f.answer == len(m.Answers) {
+			f.move++
+			f.answer = 0
+		}
+		return answer
+	}
+
+	if f.seat == noSeat {
+		f.seat = seat
+	}
+	f.goLive()
+
+	if f.live == nil || seat != f.live.Seat {
+		// The setup of the game is made by whoever starts it.
+		if seat != f.seat && seat != -1 {
+			panic(pbfMoveDone{})
+		}
+		f.endMove()
+		f.live = &pbfMove{Seat: seat, Prior: stateHash(f.lastHash())}
+	}
+
+	// The first question is for the number of players, which the dice have
+	// to know before the game starts.
+	if f.Dice != nil && len(f.Moves) == 0 && len(f.live.Answers) == 0 {
+		line := strconv.Itoa(f.Players)
+		fmt.Fprintln(output, line)
+		f.live.Answers = append(f.live.Answers, line)
+		return line
+	}
+
+	line := decideByLine(req)
+	f.live.Answers = append(f.live.Answers, recordedAnswer(req, line))
+
+	return line
+}
+
+// goLive checks the state the moves in the file end with, shows what happened
+// since the last move of the player and shows the game from now on.
+func (f *playByFile) goLive() {
+	if f.replayed {
+		return
+	}
+	f.replayed = true
+
+	if f.Result != "" {
+		panic(pbfError{errors.New("The file has a result, but its moves don't finish the game")})
+	}
+	if len(f.Moves) > 0 && stateHash(f.lastHash()) != f.Hash {
+		panic(pbfError{errors.New("The state after the last move does not match its hash, the file was changed")})
+	}
+
+	from := 0
+	for i, m := range f.Moves {
+		if m.Seat == f.seat && i+1 < len(f.offsets) {
+			from = f.offsets[i+1]
+		}
+	}
+
+	output = os.Stdout
+	if len(f.Moves) == 0 {
+		fmt.Fprintln(output, "A new game, choose the game to play.")
+	} else {
+		fmt.Fprintf(output, "Player %d, since your last move:\n", f.seat)
+	}
+	output.Write(f.log.Bytes()[from:])
+}
+
+// endMove adds the move of the player to the file.
+func (f *playByFile) endMove() {
+	if f.live != nil && len(f.live.Answers) > 0 {
+		f.Moves = append(f.Moves, *f.live)
+	}
+	f.live = nil
+}
+
+// commit is the commitment of the player running the game to their dice.
+func (f *playByFile) commit(seat int) string {
+	if !f.checkDraw(seat) {
+		return ""
+	}
+
+	secret, err := newDiceSecret()
+	if err == nil {
+		err = ioutil.WriteFile(f.secretPath, []byte(secret+"\n"), 0600)
+	}
+	if err != nil {
+		panic(pbfError{err})
+	}
+	fmt.Fprintf(output, "Your secret for the dice is in %s, keep it until the game is over.\n", f.secretPath)
+
+	return chainValue(secret, -1)
+}
+
+// reveal is the value of the player running the game for the draw.
+func (f *playByFile) reveal(seat, draw int) string {
+	if !f.checkDraw(seat) {
+		return ""
+	}
+
+	data, err := ioutil.ReadFile(f.secretPath)
+	if err != nil {
+		panic(pbfError{fmt.Errorf("Can't read your secret for the dice: %s", err)})
+	}
+
+	return chainValue(strings.TrimSpace(string(data)), draw)
+}
+
+// checkDraw reports whether the value that is missing for the draw is the
+// value of the player running the game.
+func (f *playByFile) checkDraw(seat int) bool {
+	if !f.replayed && f.move < len(f.Moves) {
+		panic(pbfError{fmt.Errorf("The dice of player %d are missing for move %d", seat, f.move+1)})
+	}
+	f.goLive()
+
+	return seat == f.seat
+}
+
+// recordedAnswer is the answer as it is written to the file.
+func recordedAnswer(req decisionRequest, line string) string {
+	lower := strings.ToLower(line)
+
+	switch req.Kind {
+	case boolDecision:
+		switch {
+		case lower == "y" || lower == "yes" || strings.HasPrefix(lower, "buy ") || strings.HasPrefix(lower, "build "):
+			return "y"
+		case lower == "n" || lower == "no":
+			return "n"
+		}
+	case choiceDecision:
+		if line == "" {
+			return line
+		}
+		var labels []string
+		for _, choice := range req.Choices {
+			if strconv.Itoa(choice.Value) == line && choice.Label != "" {
+				return choice.Label
+			}
+			labels = append(labels, choice.Label)
+		}
+		if _, err := strconv.Atoi(line); err != nil {
+			if idx, err := matchName(line, labels); err == nil && labels[idx] != "" {
+				return labels[idx]
+			}
+		}
+	}
+
+	return line
+}
+
+// replayAnswer is the answer of the file as the prompt takes it.
+func replayAnswer(req decisionRequest, answer string) string {
+	if req.Kind != choiceDecision {
+		return answer
+	}
+
+	for _, choice := range req.Choices {
+		if choice.Label != "" && choice.Label == answer {
+			return strconv.Itoa(choice.Value)
+		}
+	}
+
+	return answer
+}
+
+// runPlayByFile plays the next move of the game in the file, or starts a new
+// game when there is no file yet. A game that is over is replayed to check
+// it.
+func runPlayByFile(args []string) (err error) {
+	flags := flag.NewFlagSet("play-file", flag.ContinueOnError)
+	commitReveal := flags.Bool("commit-reveal", false, "Start a game with commit-reveal dice")
+	players := flags.Int("players", 0, "The number of players of a game with commit-reveal dice")
+	seat := flags.Int("seat", noSeat, "Your seat in a game with commit-reveal dice")
+	secret := flags.String("secret", "", "The file with your secret for the dice (default <file>.seat<N>.secret)")
+	if err = flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("Use play-file [--commit-reveal --players N] [--seat N] <file>")
+	}
+
+	f, err := loadPlayByFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *commitReveal && len(f.Moves) == 0 && f.Dice == nil {
+		if *players < 2 || *players > 4 {
+			return errors.New("A game with commit-reveal dice needs --players 2 to 4")
+		}
+		fair, ok := gameDice.(fairDice)
+		if !ok {
+			return errors.New("Commit-reveal dice are fair dice, like --dice d6 or --dice d8")
+		}
+		f.Seed = 0
+		f.Players = *players
+		f.Dice = newCommitRevealDice(*players, fair.Faces)
+	}
+
+	restore := saveGlobals()
+	defer restore()
+	mathrand.Seed(f.Seed)
+	output = &f.log
+	decide = f.decide
+
+	if f.Dice != nil {
+		if *seat < 0 || *seat >= f.Players {
+			return fmt.Errorf("Give your seat with --seat 0 to %d", f.Players-1)
+		}
+		f.seat = *seat
+		f.secretPath = *secret
+		if f.secretPath == "" {
+			f.secretPath = fmt.Sprintf("%s.seat%d.secret", f.path, f.seat)
+		}
+		f.Dice.commit = f.commit
+		f.Dice.reveal = f.reveal
+		f.Dice.install()
+	}
+
+	var stop interface{}
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				switch r := r.(type) {
+				case pbfMoveDone, diceWaiting:
+					stop = r
+				case pbfError:
+					err = r.err
+				case transcriptError:
+					err = r.err
+				default:
+					panic(r)
+				}
+			}
+		}()
+		err = playGame()
+	}()
+
+	switch {
+	case err == errGameQuit:
+		fmt.Fprintln(output, "The move was not saved.")
+		return nil
+	case err != nil:
+		return err
+	case !f.replayed:
+		if stateHash(f.lastHash()) != f.Hash {
+			return errors.New("The state after the last move does not match its hash, the file was changed")
+		}
+		output = os.Stdout
+		fmt.Fprintf(output, "The game is over, player %d won. The moves and the dice check out.\n", decisionSeat())
+		return nil
+	}
+
+	f.endMove()
+	f.Hash = stateHash(f.lastHash())
+	switch stop := stop.(type) {
+	case pbfMoveDone:
+		// The prompt of the next player is already shown.
+		fmt.Fprintln(output)
+		f.Next = decisionSeat()
+	case diceWaiting:
+		f.Next = stop.seat
+	default:
+		f.Result = "Player " + strconv.Itoa(decisionSeat()) + " won"
+	}
+	if err = f.save(); err != nil {
+		return err
+	}
+
+	switch stop := stop.(type) {
+	case pbfMoveDone:
+		fmt.Fprintf(output, "Saved to %s, it's player %d's move next.\n", f.path, f.Next)
+	case diceWaiting:
+		fmt.Fprintf(output, "Saved to %s, player %d has to %s their dice next.\n", f.path, f.Next, stop.what)
+	default:
+		fmt.Fprintf(output, "The game is over: %s. Saved to %s.\n", f.Result, f.path)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// playMoves plays moves of the game in the file, answering no to everything
+// after the setup.
+func playMoves(t *testing.T, path string, moves int) {
+	for i := 0; i < moves; i++ {
+		answers := strings.Repeat("n\n", 100)
+		if i == 0 {
+			answers = "2\n1\n" + answers
+		}
+		if err := runPlayFileWith(path, answers); err != nil {
+			t.Fatalf("Move %d: %s", i+1, err)
+		}
+	}
+}
+
+func runPlayFileWith(path, answers string) error {
+	restore := saveGlobals()
+	defer restore()
+	input = strings.NewReader(answers)
+	output = ioutil.Discard
+
+	return runPlayByFile([]string{path})
+}
+
+func readGameFile(t *testing.T, path string) map[string]interface{} {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The seed doesn't fit into a float.
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var file map[string]interface{}
+	if err = decoder.Decode(&file); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+func writeGameFile(t *testing.T, path string, file map[string]interface{}) {
+	data, err := json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlayByFileHashChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbyfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "game.json")
+	playMoves(t, path, 6)
+
+	played := readGameFile(t, path)
+	if moves := played["moves"].([]interface{}); len(moves) < 6 {
+		t.Fatalf("6 runs made %d moves", len(moves))
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(file map[string]interface{})
+		ok     bool
+		// err is the start of the error, when it is known.
+		err string
+	}{
+		{name: "as played", tamper: func(file map[string]interface{}) {}, ok: true},
+		{name: "changed answer", tamper: func(file map[string]interface{}) {
+			move := file["moves"].([]interface{})[1].(map[string]interface{})
+			answers := move["answers"].([]interface{})
+			answers[0] = "y"
+		}},
+		{name: "swapped moves", tamper: func(file map[string]interface{}) {
+			moves := file["moves"].([]interface{})
+			moves[1], moves[2] = moves[2], moves[1]
+		}, err: "Move 2 is by player"},
+		{name: "changed seed", tamper: func(file map[string]interface{}) {
+			seed, _ := file["seed"].(json.Number).Int64()
+			file["seed"] = seed + 1
+		}, err: "The state before move"},
+		{name: "changed hash", tamper: func(file map[string]interface{}) {
+			file["hash"] = strings.Repeat("0", 64)
+		}, err: "The state after the last move"},
+	}
+
+	for _, test := range tests {
+		file := readGameFile(t, path)
+		test.tamper(file)
+		tampered := filepath.Join(dir, "tampered.json")
+		writeGameFile(t, tampered, file)
+
+		err := runPlayFileWith(tampered, strings.Repeat("n\n", 100))
+		switch {
+		case test.ok && err != nil:
+			t.Errorf("%s: %s", test.name, err)
+		case !test.ok && err == nil:
+			t.Errorf("%s: the change was not found", test.name)
+		case !test.ok && !strings.HasPrefix(err.Error(), test.err):
+			t.Errorf("%s: got error '%s', want '%s'", test.name, err, test.err)
+		}
+	}
+}
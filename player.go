@@ -1,5 +1,10 @@
 package main
 
+import (
+	"errors"
+	"fmt"
+)
+
 type player struct {
 	ID            int
 	SupplyCards   map[string]*playerCard
@@ -7,3 +12,96 @@ type player struct {
 	Coins         coinSet
 	Investment    coinSet
 }
+
+// newPlayer creates a player with coins from the bank and one copy of each
+// of the cards. Landmarks that cost nothing are built from the start.
+func newPlayer(id int, coins int, cards []string) *player {
+	p := &player{ID: id}
+
+	remainder := bank.TransferTo(coins, &p.Coins)
+	if remainder > 0 {
+		fmt.Fprintf(output, "Bank did not have enough money. Missing: %d\n", remainder)
+	}
+
+	p.SupplyCards = make(map[string]*playerCard)
+	for _, name := range cards {
+		pc, ok := p.SupplyCards[name]
+		if !ok {
+			pc = &playerCard{}
+			p.SupplyCards[name] = pc
+		}
+		pc.Add(false)
+	}
+
+	p.LandmarkCards = make(map[string]bool)
+	for _, landmark := range market.LandmarkCards {
+		p.LandmarkCards[landmark.Name] = landmark.CostFor(p) == 0
+	}
+
+	return p
+}
+
+// GiveCard moves one copy of an establishment to another player. A copy that
+// is closed for renovation stays closed.
+func (p *player) GiveCard(name string, receiver *player) error {
+	pc, ok := p.SupplyCards[name]
+	if !ok {
+		return errors.New("Can't give card, player does not own it")
+	}
+
+	closed, err := pc.Remove()
+	if err != nil {
+		return err
+	}
+
+	receiverpc, ok := receiver.SupplyCards[name]
+	if !ok {
+		receiverpc = &playerCard{}
+		receiver.SupplyCards[name] = receiverpc
+	}
+	receiverpc.Add(closed)
+
+	return nil
+}
+
+func printPlayerCards(p *player) {
+	fmt.Fprintf(output, "Player %d has %d coins and cards:\n", p.ID, p.Coins.Total())
+
+	for _, card := range market.Cards {
+		pc, ok := p.SupplyCards[card.Name]
+		if !ok || pc.Total == 0 {
+			continue
+		}
+
+		fmt.Fprintf(output, "  %s [%s]\n", card.Name, pc)
+	}
+
+	fmt.Fprintln(output, "And landmarks:")
+	for _, landmark := range market.LandmarkCards {
+		if p.LandmarkCards[landmark.Name] {
+			fmt.Fprintf(output, "  %s\n", landmark.Name)
+		}
+	}
+}
+
+// HasLandmark reports whether the ability of the landmark applies to the
+// player, either because they built it or because someone built a landmark
+// whose ability applies to all players.
+func (p *player) HasLandmark(name string) bool {
+	if p.LandmarkCards[name] {
+		return true
+	}
+
+	landmark, ok := market.FindLandmark(name)
+	if !ok || !landmark.Global {
+		return false
+	}
+
+	for _, plr := range plrs {
+		if plr.LandmarkCards[name] {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,5 +1,10 @@
 package main
 
+import "fmt"
+
+// playerCard tracks the copies of one establishment a player owns. Copies are
+// identical except for whether they are closed for renovation, so it is enough
+// to count how many of the copies are closed.
 type playerCard struct {
 	Total      int
 	Renovation int
@@ -8,3 +13,58 @@ type playerCard struct {
 func (p *playerCard) Active() int {
 	return p.Total - p.Renovation
 }
+
+// Close closes up to n open copies for renovation and returns how many copies
+// were actually closed.
+func (p *playerCard) Close(n int) int {
+	if n > p.Active() {
+		n = p.Active()
+	}
+	if n < 0 {
+		n = 0
+	}
+	p.Renovation += n
+
+	return n
+}
+
+// Reopen opens all closed copies and returns how many copies were reopened.
+func (p *playerCard) Reopen() int {
+	reopened := p.Renovation
+	p.Renovation = 0
+
+	return reopened
+}
+
+// Add adds a copy, which keeps its renovation state when it comes from another
+// player.
+func (p *playerCard) Add(closed bool) {
+	p.Total++
+	if closed {
+		p.Renovation++
+	}
+}
+
+// Remove removes a copy and reports whether the removed copy was closed. Open
+// copies are removed first.
+func (p *playerCard) Remove() (bool, error) {
+	if p.Total == 0 {
+		return false, fmt.Errorf("No copies left to remove")
+	}
+
+	p.Total--
+	if p.Renovation > p.Total {
+		p.Renovation = p.Total
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (p *playerCard) String() string {
+	if p.Renovation == 0 {
+		return fmt.Sprintf("%d", p.Total)
+	}
+
+	return fmt.Sprintf("%d, %d closed", p.Total, p.Renovation)
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// prereq is a condition for an effect. Cond describes the condition as a
+// phrase, like "you have 10 or more coins", so that combined prereqs can
+// describe themselves. NotCond is the natural phrase for the opposite
+// condition, when there is one. Desc is the sentence shown before the
+// description of the effect. Compound prereqs join the conditions of other
+// prereqs, and are put in parentheses when they are joined again. NotCompound
+// is the same for NotCond.
+type prereq struct {
+	Cond        string
+	NotCond     string
+	Desc        string
+	Call        func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool
+	Compound    bool
+	NotCompound bool
+
+	// References are copied into the effects that use the prereq.
+	References effectReferences
+}
+
+var nullPrereq = prereq{
+	Desc: "",
+
+	Call: func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
+		return true
+	},
+}
+
+func newPrereq(cond string, notCond string, call func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool) prereq {
+	pr := prereq{
+		Cond:    cond,
+		NotCond: notCond,
+		Call:    call,
+	}
+	if cond != "" {
+		pr.Desc = fmt.Sprintf("If %s. ", cond)
+	}
+
+	return pr
+}
+
+// describedPrereqs are the prereqs with a condition, the null prereq has none.
+func describedPrereqs(prs []prereq) []prereq {
+	var described []prereq
+
+	for _, pr := range prs {
+		if pr.Cond != "" {
+			described = append(described, pr)
+		}
+	}
+
+	return described
+}
+
+func joinConds(prs []prereq, sep string) string {
+	var conds []string
+
+	for _, pr := range prs {
+		if pr.Compound {
+			conds = append(conds, fmt.Sprintf("(%s)", pr.Cond))
+			continue
+		}
+		conds = append(conds, pr.Cond)
+	}
+
+	return strings.Join(conds, sep)
+}
+
+// newCompoundPrereq joins the conditions of the prereqs with the word. A
+// single condition is not joined with anything and keeps its opposite.
+func newCompoundPrereq(prs []prereq, word string, notWord string, call func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool) prereq {
+	described := describedPrereqs(prs)
+
+	var pr prereq
+	switch len(described) {
+	case 0:
+		pr = newPrereq("", "", call)
+	case 1:
+		pr = newPrereq(described[0].Cond, described[0].NotCond, call)
+		pr.Compound = described[0].Compound
+		pr.NotCompound = described[0].NotCompound
+	default:
+		pr = newPrereq(joinConds(described, " "+word+" "), fmt.Sprintf("%s (%s)", notWord, joinConds(described, ", ")), call)
+		pr.Compound = true
+	}
+	pr.References = joinReferences(prs)
+
+	return pr
+}
+
+func joinReferences(prs []prereq) effectReferences {
+	var refs effectReferences
+
+	for _, pr := range prs {
+		refs = refs.merge(pr.References)
+	}
+
+	return refs
+}
+
+// newAndPrereq is met when all of the prereqs are met.
+func newAndPrereq(prs ...prereq) prereq {
+	return newCompoundPrereq(prs, "and", "not all of", func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
+		for _, pr := range prs {
+			if !pr.Call(card, rlr, p, c, pc, specialRoll) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// newOrPrereq is met when any of the prereqs is met.
+func newOrPrereq(prs ...prereq) prereq {
+	return newCompoundPrereq(prs, "or", "none of", func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
+		for _, pr := range prs {
+			if pr.Call(card, rlr, p, c, pc, specialRoll) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// newNotPrereq is met when the prereq is not met.
+func newNotPrereq(pr prereq) prereq {
+	notCond := pr.NotCond
+	if notCond == "" && pr.Cond != "" {
+		notCond = fmt.Sprintf("it is not true that %s", joinConds([]prereq{pr}, ""))
+	}
+
+	notPr := newPrereq(notCond, pr.Cond, func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
+		return !pr.Call(card, rlr, p, c, pc, specialRoll)
+	})
+	notPr.Compound = pr.NotCompound
+	notPr.NotCompound = pr.Compound
+	notPr.References = pr.References
+
+	return notPr
+}
+
+func newLandmarkPrereq(name string, forRoller bool) prereq {
+	owner := "you have"
+	notOwner := "you don't have"
+	if forRoller {
+		owner = "the player who rolled the dice has"
+		notOwner = "the player who rolled the dice doesn't have"
+	}
+
+	pr := newPrereq(
+		fmt.Sprintf("%s the [%s] landmark", owner, name),
+		fmt.Sprintf("%s the [%s] landmark", notOwner, name),
+		func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
+			if forRoller {
+				return rlr.HasLandmark(name)
+			}
+			return p.HasLandmark(name)
+		},
+	)
+	pr.References = effectReferences{Landmarks: []string{name}}
+
+	return pr
+}
+
+func newLandmarkMaxPrereq(max int) prereq {
+	return newPrereq(
+		fmt.Sprintf("the player who rolled the dice has fewer than %d constructed landmarks (excluding City Hall)", max),
+		fmt.Sprintf("the player who rolled the dice has %d or more constructed landmarks (excluding City Hall)", max),
+		func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
+			return landmarkCount(rlr) < max
+		},
+	)
+}
+
+func landmarkCount(p *player) int {
+	var count int
+
+	for name, active := range p.LandmarkCards {
+		if name == "City Hall" {
+			continue
+		}
+
+		if active {
+			count++
+		}
+	}
+
+	return count
+}
+
+func newLandmarkMinPrereq(min int) prereq {
+	return newPrereq(
+		fmt.Sprintf("the player who rolled the dice has %d or more constructed landmarks (excluding City Hall)", min+1),
+		fmt.Sprintf("the player who rolled the dice has fewer than %d constructed landmarks (excluding City Hall)", min+1),
+		func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
+			return landmarkCount(rlr) > min
+		},
+	)
+}
+
+func newFewestLandmarksPrereq() prereq {
+	return newPrereq(
+		"you have the fewest constructed landmarks (excluding City Hall)",
+		"another player has fewer constructed landmarks (excluding City Hall)",
+		func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
+			for _, plr := range plrs {
+				if landmarkCount(plr) < landmarkCount(p) {
+					return false
+				}
+			}
+			return true
+		},
+	)
+}
+
+func newSpecialRollMinPrereq(min int) prereq {
+	return newPrereq(
+		fmt.Sprintf("a roll of 2 dice is %d or more", min),
+		fmt.Sprintf("a roll of 2 dice is less than %d", min),
+		func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
+			return specialRoll >= min
+		},
+	)
+}
+
+func newCoinsMinPrereq(min int) prereq {
+	return newPrereq(
+		fmt.Sprintf("you have %d or more coins", min),
+		fmt.Sprintf("you have fewer than %d coins", min),
+		func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
+			return p.Coins.Total() >= min
+		},
+	)
+}
+
+func newCoinsMaxPrereq(max int) prereq {
+	return newPrereq(
+		fmt.Sprintf("you have fewer than %d coins", max),
+		fmt.Sprintf("you have %d or more coins", max),
+		func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
+			return p.Coins.Total() < max
+		},
+	)
+}
+
+func iconCardCount(p *player, icon cardIcon) int {
+	var count int
+
+	for _, iconCard := range market.FindByIcon(icon) {
+		if pc, ok := p.SupplyCards[iconCard.Name]; ok {
+			count += pc.Total
+		}
+	}
+
+	return count
+}
+
+func newIconMinPrereq(icon cardIcon, min int) prereq {
+	pr := newPrereq(
+		fmt.Sprintf("you have at least %d [%s]", min, icon),
+		fmt.Sprintf("you have fewer than %d [%s]", min, icon),
+		func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
+			return iconCardCount(p, icon) >= min
+		},
+	)
+	pr.References = effectReferences{Icons: []cardIcon{icon}}
+
+	return pr
+}
+
+func newRollerPrereq() prereq {
+	return newPrereq(
+		"it is your turn",
+		"it is not your turn",
+		func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
+			return p == rlr
+		},
+	)
+}
+
+func rangePhrase(min int, max int) string {
+	if min == max {
+		return fmt.Sprintf("%d", min)
+	}
+
+	return fmt.Sprintf("between %d and %d", min, max)
+}
+
+// newRollRangePrereq checks the roll of the current turn, after any changes
+// to the roll like the one from the Harbor.
+func newRollRangePrereq(min int, max int) prereq {
+	return newPrereq(
+		fmt.Sprintf("the dice roll is %s", rangePhrase(min, max)),
+		fmt.Sprintf("the dice roll is not %s", rangePhrase(min, max)),
+		func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
+			if currentTurn == nil {
+				return false
+			}
+			return currentTurn.Roll >= min && currentTurn.Roll <= max
+		},
+	)
+}
+
+func newPlayerCountPrereq(min int, max int) prereq {
+	return newPrereq(
+		fmt.Sprintf("the number of players is %s", rangePhrase(min, max)),
+		fmt.Sprintf("the number of players is not %s", rangePhrase(min, max)),
+		func(card supplyCard, rlr *player, p *player, c int, pc *playerCard, specialRoll int) bool {
+			return len(plrs) >= min && len(plrs) <= max
+		},
+	)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestPrereqDescriptions(t *testing.T) {
+	gears := newIconMinPrereq(gearIcon, 2)
+	poor := newCoinsMaxPrereq(10)
+	roller := newRollerPrereq()
+
+	tests := []struct {
+		pr      prereq
+		desc    string
+		notCond string
+	}{
+		{pr: newAndPrereq(gears, poor), desc: "If you have at least 2 [Gear] and you have fewer than 10 coins. ", notCond: "not all of (you have at least 2 [Gear], you have fewer than 10 coins)"},
+		{pr: newOrPrereq(roller, newAndPrereq(gears, poor)), desc: "If it is your turn or (you have at least 2 [Gear] and you have fewer than 10 coins). "},
+		{pr: newAndPrereq(newOrPrereq(roller, poor), gears), desc: "If (it is your turn or you have fewer than 10 coins) and you have at least 2 [Gear]. "},
+		{pr: newNotPrereq(newOrPrereq(roller, poor)), desc: "If none of (it is your turn, you have fewer than 10 coins). ", notCond: "it is your turn or you have fewer than 10 coins"},
+		{pr: newNotPrereq(roller), desc: "If it is not your turn. ", notCond: "it is your turn"},
+		{pr: newAndPrereq(newNotPrereq(newNotPrereq(newOrPrereq(roller, poor))), gears), desc: "If (it is your turn or you have fewer than 10 coins) and you have at least 2 [Gear]. "},
+		{pr: newAndPrereq(newNotPrereq(newOrPrereq(roller, poor)), gears), desc: "If none of (it is your turn, you have fewer than 10 coins) and you have at least 2 [Gear]. "},
+		{pr: newOrPrereq(newNotPrereq(prereq{Cond: "a or b", Compound: true}), gears), desc: "If it is not true that (a or b) or you have at least 2 [Gear]. "},
+		{pr: newAndPrereq(nullPrereq, nullPrereq), desc: ""},
+		{pr: newOrPrereq(nullPrereq), desc: ""},
+		{pr: newAndPrereq(nullPrereq, poor), desc: "If you have fewer than 10 coins. ", notCond: "you have 10 or more coins"},
+		{pr: newAndPrereq(newAndPrereq(roller, poor)), desc: "If it is your turn and you have fewer than 10 coins. "},
+		{pr: newRollRangePrereq(11, 12), desc: "If the dice roll is between 11 and 12. "},
+		{pr: newPlayerCountPrereq(2, 2), desc: "If the number of players is 2. "},
+		{pr: newCoinsMinPrereq(5), desc: "If you have 5 or more coins. ", notCond: "you have fewer than 5 coins"},
+	}
+
+	for _, test := range tests {
+		if test.pr.Desc != test.desc {
+			t.Errorf("The description is '%s', want '%s'", test.pr.Desc, test.desc)
+		}
+		if test.notCond != "" && test.pr.NotCond != test.notCond {
+			t.Errorf("The opposite of '%s' is '%s', want '%s'", test.pr.Cond, test.pr.NotCond, test.notCond)
+		}
+	}
+
+	if refs := newAndPrereq(gears, poor).References; len(refs.Icons) != 1 || refs.Icons[0] != gearIcon {
+		t.Errorf("The references of the prereqs are %v, want the [Gear] icon", refs)
+	}
+}
+
+func TestPrereqCall(t *testing.T) {
+	restore := saveGlobals()
+	defer restore()
+	output = ioutil.Discard
+	if err := initBasic(); err != nil {
+		t.Fatal(err)
+	}
+
+	rich := newPlayer(1, 12, []string{"Forest", "Mine", "Bakery"})
+	poor := newPlayer(2, 3, []string{"Forest"})
+	plrs = []*player{rich, poor}
+	currentTurn = &turn{Roller: rich, Roll: 11}
+
+	tests := []struct {
+		name string
+		pr   prereq
+		p    *player
+		want bool
+	}{
+		{name: "2 gears and 12 coins", pr: newAndPrereq(newIconMinPrereq(gearIcon, 2), newCoinsMaxPrereq(10)), p: rich, want: false},
+		{name: "2 gears or 12 coins", pr: newOrPrereq(newIconMinPrereq(gearIcon, 2), newCoinsMaxPrereq(10)), p: rich, want: true},
+		{name: "1 gear and 3 coins", pr: newAndPrereq(newIconMinPrereq(gearIcon, 2), newCoinsMaxPrereq(10)), p: poor, want: false},
+		{name: "1 gear or 3 coins", pr: newOrPrereq(newIconMinPrereq(gearIcon, 1), newCoinsMinPrereq(10)), p: poor, want: true},
+		{name: "not the roller", pr: newNotPrereq(newRollerPrereq()), p: poor, want: true},
+		{name: "the roller", pr: newRollerPrereq(), p: rich, want: true},
+		{name: "roll of 11", pr: newRollRangePrereq(11, 12), p: poor, want: true},
+		{name: "roll below 11", pr: newRollRangePrereq(2, 10), p: poor, want: false},
+		{name: "2 players", pr: newPlayerCountPrereq(3, 4), p: poor, want: false},
+		{name: "nested", pr: newOrPrereq(newPlayerCountPrereq(3, 4), newAndPrereq(newRollerPrereq(), newCoinsMinPrereq(12))), p: rich, want: true},
+		{name: "only null prereqs", pr: newAndPrereq(nullPrereq, nullPrereq), p: poor, want: true},
+	}
+
+	for _, test := range tests {
+		if got := test.pr.Call(supplyCard{}, rich, test.p, 1, nil, 0); got != test.want {
+			t.Errorf("%s: the prereq is %t, want %t", test.name, got, test.want)
+		}
+	}
+
+	currentTurn = nil
+	if newRollRangePrereq(1, 12).Call(supplyCard{}, rich, rich, 1, nil, 0) {
+		t.Error("The roll range is met outside of a turn")
+	}
+}
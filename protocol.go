@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	textProtocol  = "text"
+	jsonlProtocol = "jsonl"
+)
+
+// jsonlMessage is a line written by the JSON-lines protocol. Events are the
+// lines the game prints, turns and rolls tell whose turn it is and what they
+// rolled, decisions are the prompts with their legal choices and the state of
+// the game, errors are answers that were not accepted and the end is the last
+// message of a game.
+type jsonlMessage struct {
+	Type string `json:"type"`
+	ID   int    `json:"id,omitempty"`
+	Text string `json:"text,omitempty"`
+	// Seat is the player who has to make the decision, or -1 when it is a
+	// decision about the game itself, like the version to play. For turns
+	// and rolls it is the player whose turn it is.
+	Seat *int `json:"seat,omitempty"`
+	// Dice are the faces of the dice of a roll, and Total the roll.
+	Dice  []int `json:"dice,omitempty"`
+	Total int   `json:"total,omitempty"`
+	*decisionRequest
+	State  *gameState `json:"state,omitempty"`
+	Result string     `json:"result,omitempty"`
+	// Clock is only sent by the game server, for games with a time control.
+	Clock *clockStatus `json:"clock,omitempty"`
+}
+
+// jsonlDecision is a line read by the JSON-lines protocol. The value is a
+// number or a label for choices, true or false for yes or no questions and a
+// string for texts. A missing value skips an optional choice.
+type jsonlDecision struct {
+	ID    int         `json:"id"`
+	Value interface{} `json:"value"`
+}
+
+// jsonlProtocolIO is the output and the decision maker of the game in the
+// JSON-lines protocol, nothing else is written to the standard output.
+type jsonlProtocolIO struct {
+	in      *bufio.Reader
+	out     *json.Encoder
+	pending string
+	lastID  int
+}
+
+func newJSONLProtocolIO(in io.Reader, out io.Writer) *jsonlProtocolIO {
+	return &jsonlProtocolIO{
+		in:  bufio.NewReader(in),
+		out: json.NewEncoder(out),
+	}
+}
+
+func (j *jsonlProtocolIO) send(msg jsonlMessage) {
+	j.out.Encode(msg)
+}
+
+// Write sends each finished line of the output as an event. The unfinished
+// line is the prompt of the next decision.
+func (j *jsonlProtocolIO) Write(b []byte) (int, error) {
+	lines := strings.Split(j.pending+string(b), "\n")
+	for _, line := range lines[:len(lines)-1] {
+		j.send(jsonlMessage{Type: "event", Text: line})
+	}
+	j.pending = lines[len(lines)-1]
+
+	return len(b), nil
+}
+
+// announce sends the turns and the rolls.
+func (j *jsonlProtocolIO) announce(a announcement) {
+	seat := a.Seat
+	j.send(jsonlMessage{Type: a.Kind, Seat: &seat, Dice: a.Dice, Total: a.Total})
+}
+
+// decide sends the decision request and reads decisions until one of them
+// is legal. It returns the decision as the line a player would type.
+func (j *jsonlProtocolIO) decide(req decisionRequest) string {
+	req.Prompt = strings.TrimSpace(strings.TrimSuffix(j.pending, "(y/n) "))
+	j.pending = ""
+
+	j.lastID++
+	state := gameSnapshot()
+	seat := decisionSeat()
+	j.send(jsonlMessage{Type: "decision", ID: j.lastID, Seat: &seat, decisionRequest: &req, State: &state})
+
+	for {
+		line, err := j.in.ReadString('\n')
+		if strings.TrimSpace(line) == "" {
+			if err != nil {
+				panic(gameQuit{})
+			}
+			continue
+		}
+
+		answer, err := parseJSONLDecision(req, j.lastID, line)
+		if err != nil {
+			j.send(jsonlMessage{Type: "error", ID: j.lastID, Text: err.Error()})
+			continue
+		}
+
+		return answer
+	}
+}
+
+// decisionSeat is the player who makes the decisions of the turn.
+func decisionSeat() int {
+	if currentTurn == nil {
+		return -1
+	}
+
+	return currentTurn.Roller.ID
+}
+
+// parseJSONLDecision checks that the decision is legal for the open request
+// with the id, and returns it as the line a player would type.
+func parseJSONLDecision(req decisionRequest, id int, line string) (string, error) {
+	var decision jsonlDecision
+	if err := json.Unmarshal([]byte(line), &decision); err != nil {
+		return "", fmt.Errorf("Invalid decision: %s", err)
+	}
+	if decision.ID != 0 && decision.ID != id {
+		return "", fmt.Errorf("Decision %d is not the open decision %d", decision.ID, id)
+	}
+
+	switch value := decision.Value.(type) {
+	case nil:
+		if req.Optional {
+			return "", nil
+		}
+	case bool:
+		if req.Kind == boolDecision {
+			if value {
+				return "y", nil
+			}
+			return "n", nil
+		}
+	case float64:
+		for _, choice := range req.Choices {
+			if float64(choice.Value) != value {
+				continue
+			}
+			if req.Kind == boolDecision {
+				return map[int]string{0: "n", 1: "y"}[choice.Value], nil
+			}
+			return strconv.Itoa(choice.Value), nil
+		}
+	case string:
+		if req.Kind == textDecision {
+			return value, nil
+		}
+		for _, choice := range req.Choices {
+			if !strings.EqualFold(choice.Label, value) {
+				continue
+			}
+			if req.Kind == boolDecision {
+				return map[int]string{0: "n", 1: "y"}[choice.Value], nil
+			}
+			return strconv.Itoa(choice.Value), nil
+		}
+	}
+
+	return "", fmt.Errorf("%v is not a legal decision", decision.Value)
+}
+
+// startJSONLProtocol makes the game use the JSON-lines protocol on the
+// standard input and output.
+func startJSONLProtocol() *jsonlProtocolIO {
+	protocol := newJSONLProtocolIO(os.Stdin, os.Stdout)
+	output = protocol
+	decide = protocol.decide
+	announce = protocol.announce
+	menusInDecisions = true
+
+	return protocol
+}
+
+// end sends the result of the game.
+func (j *jsonlProtocolIO) end(err error) {
+	result := "won"
+	if err == errGameQuit {
+		result = "quit"
+	} else if err != nil {
+		result = err.Error()
+	}
+	if j.pending != "" {
+		j.Write([]byte("\n"))
+	}
+	j.send(jsonlMessage{Type: "end", Result: result})
+}
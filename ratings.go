@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Ratings are Glicko-2 ratings from the match history, one pool for each
+// version. A game of 3 or 4 players counts as a game between each pair of
+// them, won by the one with the better place. Profiles and bots are rated in
+// the same pool, so that bots can be compared with the players. Seats without
+// a profile or a bot are not rated, they are not the same player from game to
+// game.
+
+const (
+	defaultRating     = 1500.0
+	defaultDeviation  = 350.0
+	defaultVolatility = 0.06
+	// glickoScale converts ratings to the scale of Glicko-2, and glickoTau
+	// limits how fast the volatility changes.
+	glickoScale = 173.7178
+	glickoTau   = 0.5
+)
+
+type rating struct {
+	Name       string
+	Rating     float64
+	Deviation  float64
+	Volatility float64
+	Games      int
+	// History is the rating after each game.
+	History []float64
+}
+
+func newRating(name string) *rating {
+	return &rating{Name: name, Rating: defaultRating, Deviation: defaultDeviation, Volatility: defaultVolatility}
+}
+
+// trend is how much the rating changed over the last games.
+func (r *rating) trend(games int) float64 {
+	if len(r.History) == 0 {
+		return 0
+	}
+	before := defaultRating
+	if len(r.History) > games {
+		before = r.History[len(r.History)-games-1]
+	}
+
+	return r.Rating - before
+}
+
+// glickoResult is a result against an opponent, with the rating of the
+// opponent before the game.
+type glickoResult struct {
+	mu, phi float64
+	score   float64
+}
+
+func glickoG(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func glickoE(mu, muj, phij float64) float64 {
+	return 1 / (1 + math.Exp(-glickoG(phij)*(mu-muj)))
+}
+
+// update rates the results of a game, the Glicko-2 rating period of the
+// player.
+func (r *rating) update(results []glickoResult) {
+	mu := (r.Rating - defaultRating) / glickoScale
+	phi := r.Deviation / glickoScale
+
+	var vInv, sum float64
+	for _, res := range results {
+		g := glickoG(res.phi)
+		e := glickoE(mu, res.mu, res.phi)
+		vInv += g * g * e * (1 - e)
+		sum += g * (res.score - e)
+	}
+	v := 1 / vInv
+	delta := v * sum
+
+	sigma := newVolatility(phi, v, delta, r.Volatility)
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu += phi * phi * sum
+
+	r.Rating = defaultRating + glickoScale*mu
+	r.Deviation = glickoScale * phi
+	r.Volatility = sigma
+	r.Games++
+	r.History = append(r.History, r.Rating)
+}
+
+// newVolatility is the volatility after the game, by the iteration of the
+// Glicko-2 paper.
+func newVolatility(phi, v, delta, sigma float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(glickoTau*glickoTau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*glickoTau) < 0 {
+			k++
+		}
+		B = a - k*glickoTau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > 0.000001 {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+
+	return math.Exp(A / 2)
+}
+
+// ratedName is the name the seat is rated by, or nothing when the seat is not
+// rated.
+func (r matchRecord) ratedName(seat int) string {
+	for _, s := range r.Seats {
+		if s.Seat != seat {
+			continue
+		}
+		if s.Name != "" {
+			return s.Name
+		}
+		if s.Bot != "" {
+			return "bot " + s.Bot
+		}
+	}
+
+	return ""
+}
+
+// rateMatches rates the players of the matches, in order, by version.
+func rateMatches(records []matchRecord) map[string]map[string]*rating {
+	pools := make(map[string]map[string]*rating)
+
+	for _, record := range records {
+		var names []string
+		rated := 0
+		for _, s := range record.Standings {
+			name := record.ratedName(s.Seat)
+			names = append(names, name)
+			if name != "" {
+				rated++
+			}
+		}
+		// A game against only unrated seats says nothing about the player.
+		if rated < 2 {
+			continue
+		}
+		pool, ok := pools[record.Version]
+		if !ok {
+			pool = make(map[string]*rating)
+			pools[record.Version] = pool
+		}
+
+		var players []*rating
+		for _, name := range names {
+			if name == "" {
+				players = append(players, nil)
+				continue
+			}
+			key := strings.ToLower(name)
+			if pool[key] == nil {
+				pool[key] = newRating(name)
+			}
+			players = append(players, pool[key])
+		}
+
+		// All results of the game are against the ratings before it.
+		var results [][]glickoResult
+		for i, p := range players {
+			var res []glickoResult
+			for j, o := range players {
+				if p == nil || o == nil || i == j || o == p {
+					continue
+				}
+				score := 0.0
+				if i < j {
+					score = 1
+				}
+				res = append(res, glickoResult{
+					mu:    (o.Rating - defaultRating) / glickoScale,
+					phi:   o.Deviation / glickoScale,
+					score: score,
+				})
+			}
+			results = append(results, res)
+		}
+		for i, p := range players {
+			if p != nil && len(results[i]) > 0 {
+				p.update(results[i])
+			}
+		}
+	}
+
+	return pools
+}
+
+// runRatings shows the leaderboard of each version, or of one.
+func runRatings(args []string) error {
+	flags := flag.NewFlagSet("ratings", flag.ContinueOnError)
+	version := flags.String("version", "", "Only the leaderboard of the version")
+	recent := flags.Int("recent", 5, "The number of games the trend is over")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errors.New("Use ratings [--version name] [--recent games]")
+	}
+
+	records, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	pools := rateMatches(records)
+
+	var versions []string
+	for v := range pools {
+		if *version == "" || strings.EqualFold(v, *version) {
+			versions = append(versions, v)
+		}
+	}
+	sort.Strings(versions)
+
+	shown := false
+	for _, v := range versions {
+		var board []*rating
+		for _, r := range pools[v] {
+			if r.Games > 0 {
+				board = append(board, r)
+			}
+		}
+		if len(board) == 0 {
+			continue
+		}
+		sort.Slice(board, func(i, j int) bool {
+			if board[i].Rating != board[j].Rating {
+				return board[i].Rating > board[j].Rating
+			}
+			return board[i].Name < board[j].Name
+		})
+
+		if shown {
+			fmt.Fprintln(output)
+		}
+		shown = true
+		fmt.Fprintf(output, "%s:\n", v)
+		for i, r := range board {
+			fmt.Fprintf(output, "  %2d. %-20s %5.0f ±%3.0f  %3d games  %+4.0f over the last %d\n", i+1, r.Name, r.Rating, 2*r.Deviation, r.Games, r.trend(*recent), *recent)
+		}
+	}
+
+	if !shown {
+		fmt.Fprintln(output, "No rated games yet, play with --names or with bots to rate the players.")
+	}
+
+	return nil
+}
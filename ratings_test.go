@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// TestGlickoExample checks the example of the Glicko-2 paper.
+func TestGlickoExample(t *testing.T) {
+	r := &rating{Name: "example", Rating: 1500, Deviation: 200, Volatility: 0.06}
+
+	opponent := func(rating, deviation, score float64) glickoResult {
+		return glickoResult{
+			mu:    (rating - defaultRating) / glickoScale,
+			phi:   deviation / glickoScale,
+			score: score,
+		}
+	}
+	r.update([]glickoResult{
+		opponent(1400, 30, 1),
+		opponent(1550, 100, 0),
+		opponent(1700, 300, 0),
+	})
+
+	if math.Abs(r.Rating-1464.06) > 0.01 {
+		t.Errorf("Rating is %f, want 1464.06", r.Rating)
+	}
+	if math.Abs(r.Deviation-151.52) > 0.01 {
+		t.Errorf("Deviation is %f, want 151.52", r.Deviation)
+	}
+	if math.Abs(r.Volatility-0.05999) > 0.00001 {
+		t.Errorf("Volatility is %f, want 0.05999", r.Volatility)
+	}
+	if r.Games != 1 || len(r.History) != 1 {
+		t.Errorf("Games is %d with %d ratings in the history, want 1", r.Games, len(r.History))
+	}
+}
+
+func testRecord(version string, seats []matchSeat, places ...int) matchRecord {
+	record := matchRecord{Version: version, Seats: seats}
+	for i, seat := range places {
+		record.Standings = append(record.Standings, matchStanding{Place: i + 1, Seat: seat})
+	}
+
+	return record
+}
+
+func TestRateMatches(t *testing.T) {
+	seats := []matchSeat{
+		{Seat: 0, Name: "Alice"},
+		{Seat: 1, Bot: "./easy"},
+		{Seat: 2},
+		{Seat: 3, Name: "bob"},
+	}
+	records := []matchRecord{
+		testRecord("Basic", seats, 0, 1, 2, 3),
+		testRecord("Basic", []matchSeat{{Seat: 0, Name: "alice"}, {Seat: 1, Name: "Bob"}}, 0, 1),
+		testRecord("Machi Koro 2", seats[:2], 1, 0),
+		testRecord("Basic", []matchSeat{{Seat: 0}, {Seat: 1, Name: "carol"}}, 0, 1),
+	}
+
+	pools := rateMatches(records)
+	if len(pools) != 2 {
+		t.Fatalf("There are %d pools, want one for each of the 2 versions", len(pools))
+	}
+
+	basic := pools["Basic"]
+	if len(basic) != 3 {
+		t.Errorf("Basic rates %d players, want alice, bob and the bot", len(basic))
+	}
+	alice, bob, bot := basic["alice"], basic["bob"], basic["bot ./easy"]
+	if alice == nil || bob == nil || bot == nil {
+		t.Fatalf("Basic rates %v, want alice, bob and the bot", basic)
+	}
+	if alice.Name != "Alice" {
+		t.Errorf("Alice is rated as %s, want the name of her first game", alice.Name)
+	}
+	if alice.Games != 2 || bob.Games != 2 || bot.Games != 1 {
+		t.Errorf("Games are %d, %d and %d, want 2, 2 and 1", alice.Games, bob.Games, bot.Games)
+	}
+	if !(alice.Rating > bot.Rating && bot.Rating > bob.Rating) {
+		t.Errorf("Ratings are %f, %f and %f, want alice over the bot over bob", alice.Rating, bot.Rating, bob.Rating)
+	}
+	if alice.Deviation >= defaultDeviation || bob.Deviation >= defaultDeviation {
+		t.Error("The deviation did not go down with the games")
+	}
+	if _, ok := basic["carol"]; ok {
+		t.Error("Carol is rated for a game against an unrated seat")
+	}
+
+	mk2 := pools["Machi Koro 2"]
+	if mk2["bot ./easy"].Rating <= defaultRating || mk2["alice"].Rating >= defaultRating {
+		t.Error("The bot won in Machi Koro 2 but is not rated higher than alice")
+	}
+}
+
+func TestRatingTrend(t *testing.T) {
+	r := newRating("alice")
+	if r.trend(5) != 0 {
+		t.Errorf("The trend without games is %f, want 0", r.trend(5))
+	}
+
+	r.History = []float64{1600, 1650, 1620, 1700}
+	r.Rating = 1700
+	tests := []struct {
+		games int
+		want  float64
+	}{
+		{games: 1, want: 80},
+		{games: 2, want: 50},
+		{games: 3, want: 100},
+		{games: 4, want: 200},
+		{games: 10, want: 200},
+	}
+	for _, test := range tests {
+		if got := r.trend(test.games); got != test.want {
+			t.Errorf("The trend over %d games is %f, want %f", test.games, got, test.want)
+		}
+	}
+}
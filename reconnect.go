@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Players of the game server who lose their connection, a WebSocket or a TCP
+// connection, get their seat back when they connect again with the token of
+// the seat, and players who play with HTTP requests get it back with their
+// next request. The game waits for them for the grace period, then the
+// takeover bot of the server makes their decisions until they are back.
+// Without a takeover bot the default decisions are made, so that the game
+// never waits for a player who is gone, not even in the middle of an effect.
+
+// defaultGracePeriod is how long the game waits for a player to reconnect.
+const defaultGracePeriod = 60 * time.Second
+
+// connect counts a connection of the seat, and hands the seat back to its
+// player when a bot plays it.
+func (g *serverGame) connect(seat int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s := g.seats[seat]
+	s.connections++
+	if s.connections > 1 {
+		return
+	}
+
+	if s.remote && g.result == "" {
+		g.addEvent(fmt.Sprintf("Player %d is back.", seat))
+	}
+	s.remote = true
+	g.handBack(seat)
+}
+
+// present hands the seat back to a player who plays it with HTTP requests.
+// Every request with the token of the seat shows that the player is there. It
+// is called with the lock held.
+func (g *serverGame) present(seat int) {
+	s := g.seats[seat]
+	if s.Away && g.result == "" {
+		g.addEvent(fmt.Sprintf("Player %d is back.", seat))
+	}
+	g.handBack(seat)
+}
+
+// handBack stops the grace period and the takeover of the seat. It is called
+// with the lock held.
+func (g *serverGame) handBack(seat int) {
+	s := g.seats[seat]
+	s.stopGrace()
+	s.Away = false
+
+	if s.takeover != nil && !s.deciding {
+		go s.takeover.Close()
+	}
+	s.takeover = nil
+}
+
+// disconnect counts down the connections of the seat. When the last one is
+// gone, the seat is taken over after the grace period.
+func (g *serverGame) disconnect(seat int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s := g.seats[seat]
+	s.connections--
+	if s.connections > 0 || g.result != "" {
+		return
+	}
+
+	g.addEvent(fmt.Sprintf("Player %d left, the game waits %s for them to come back.", seat, g.grace))
+	g.startGrace(seat)
+}
+
+// waitForAbsent starts the grace period when the open decision is for a seat
+// without a connection, like a seat that is played with HTTP requests or that
+// nobody joined. It is called with the lock held.
+func (g *serverGame) waitForAbsent() {
+	if g.decision == nil || g.decision.Seat == nil || *g.decision.Seat < 0 || g.result != "" {
+		return
+	}
+	seat := *g.decision.Seat
+	s := g.seats[seat]
+	if s.Bot != "" || s.connections > 0 || s.Away || s.grace != nil {
+		return
+	}
+
+	g.addEvent(fmt.Sprintf("Player %d is not connected, the game waits %s for them.", seat, g.grace))
+	g.startGrace(seat)
+}
+
+// startGrace takes over the seat after the grace period. It is called with
+// the lock held.
+func (g *serverGame) startGrace(seat int) {
+	g.seats[seat].grace = time.AfterFunc(g.grace, func() {
+		g.takeOver(seat)
+	})
+}
+
+func (s *serverSeat) stopGrace() {
+	if s.grace != nil {
+		s.grace.Stop()
+		s.grace = nil
+	}
+}
+
+// takeOver lets the takeover bot or the default decisions play the seat.
+func (g *serverGame) takeOver(seat int) {
+	var bot *botPlayer
+	if g.takeoverBot != "" {
+		var err error
+		bot, err = startBot(seat, g.takeoverBot, defaultBotTimeout)
+		if err != nil {
+			log.Printf("Game %s: %s", g.ID, err)
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s := g.seats[seat]
+	if s.connections > 0 || g.result != "" {
+		if bot != nil {
+			go bot.Close()
+		}
+		return
+	}
+
+	s.grace = nil
+	s.Away = true
+	s.takeover = bot
+	s.botSent = len(g.events)
+	if bot != nil {
+		g.addEvent(fmt.Sprintf("A bot plays for player %d until they are back.", seat))
+	} else {
+		g.addEvent(fmt.Sprintf("Player %d gets the default decisions until they are back.", seat))
+	}
+
+	g.decideForAway()
+}
+
+// decideForAway makes the open decision when its player is away. It is
+// called with the lock held.
+func (g *serverGame) decideForAway() {
+	if g.decision == nil || g.decision.Seat == nil || *g.decision.Seat < 0 {
+		return
+	}
+	seat := *g.decision.Seat
+	s := g.seats[seat]
+	if !s.Away || s.deciding {
+		return
+	}
+
+	s.deciding = true
+	go g.decideFor(seat, *g.decision)
+}
+
+// decideFor asks the bot of the seat for the decision, or makes the default
+// decision. The decision is only sent when it is still open and the player is
+// still away.
+func (g *serverGame) decideFor(seat int, msg jsonlMessage) {
+	req := *msg.decisionRequest
+
+	g.mu.Lock()
+	s := g.seats[seat]
+	bot := s.takeover
+	var events []string
+	for _, event := range g.events[s.botSent:] {
+		if event.Type == "event" {
+			events = append(events, event.Text)
+		}
+	}
+	s.botSent = len(g.events)
+	if bot != nil {
+		bot.events = events
+	}
+	state := gameState{}
+	if g.state != nil {
+		state = *g.state
+	}
+	g.mu.Unlock()
+
+	line := defaultDecision(req)
+	if bot != nil {
+		line = bot.decideState(req, state)
+	}
+	value, _, err := lineDecision(req, line)
+	if err != nil {
+		value, _, _ = lineDecision(req, defaultDecision(req))
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s.deciding = false
+	if bot != nil && s.takeover != bot {
+		// The player came back while the bot was thinking.
+		go bot.Close()
+	}
+	if !s.Away || g.decision == nil || g.decision.ID != msg.ID {
+		return
+	}
+
+	g.send(msg.ID, value)
+}
+
+// endTakeovers stops waiting for players and stops the takeover bots at the
+// end of the game. It is called with the lock held.
+func (g *serverGame) endTakeovers() {
+	for _, s := range g.seats {
+		if s.grace != nil {
+			s.grace.Stop()
+			s.grace = nil
+		}
+		if s.takeover != nil && !s.deciding {
+			go s.takeover.Close()
+		}
+		s.takeover = nil
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// scenario is a rules test. It gives the state of a game, forces the rolls
+// and decisions of some turns and checks the state after them. Scenarios are
+// JSON files, so that rulings can be collected without writing Go code.
+type scenario struct {
+	Name string `json:"name"`
+	gameState
+	Turns  []scenarioTurn    `json:"turns"`
+	Expect scenarioExpection `json:"expect"`
+}
+
+// gameState is the state of a game, as the start of a scenario or as a saved
+// game.
+type gameState struct {
+	Version string `json:"version"`
+	// Market replaces the establishments on the market, so that purchase
+	// choices don't depend on the random market layout. It maps the name of
+	// the card to the number of cards left.
+	Market  map[string]int   `json:"market"`
+	Players []scenarioPlayer `json:"players"`
+}
+
+type scenarioPlayer struct {
+	Coins      int            `json:"coins"`
+	Investment int            `json:"investment"`
+	Cards      map[string]int `json:"cards"`
+	Closed     map[string]int `json:"closed"`
+	Landmarks  []string       `json:"landmarks"`
+}
+
+// scenarioTurn is a turn of the roller. Rolls are the dice of each roll, a
+// re-roll takes the next one. Decisions are the answers to the prompts of the
+// turn, in order.
+type scenarioTurn struct {
+	Roller      int      `json:"roller"`
+	Rolls       [][]int  `json:"rolls"`
+	SpecialRoll int      `json:"special_roll"`
+	Decisions   []string `json:"decisions"`
+}
+
+// scenarioExpection is the state after the turns. Players that are missing or
+// null are not checked, and neither are their cards and landmarks when they
+// are not set. The market is only checked when it is set.
+type scenarioExpection struct {
+	Players []*scenarioPlayer `json:"players"`
+	Market  map[string]int    `json:"market"`
+	Winner  *int              `json:"winner"`
+}
+
+// scenarioAbort is the panic used to stop a scenario when it runs out of
+// forced rolls or decisions.
+type scenarioAbort struct {
+	Reason string
+}
+
+// scriptedInput reads the decisions of a turn, and aborts the scenario when a
+// prompt asks for more.
+type scriptedInput struct {
+	r io.Reader
+}
+
+func (s *scriptedInput) Read(b []byte) (int, error) {
+	n, err := s.r.Read(b)
+	if n == 0 && err == io.EOF {
+		panic(scenarioAbort{Reason: "The turn asked for more decisions than given"})
+	}
+
+	return n, err
+}
+
+func loadScenario(path string) (scenario, error) {
+	var s scenario
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if err = json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("Could not read scenario %s: %s", path, err)
+	}
+	if s.Name == "" {
+		s.Name = filepath.Base(path)
+	}
+
+	return s, nil
+}
+
+func findGameVersion(name string) (gameVersion, bool) {
+	for _, version := range gameVersionsSorted {
+		if version.Name == name {
+			return version, true
+		}
+	}
+
+	return gameVersion{}, false
+}
+
+// setUp initializes the version and the players of the scenario.
+func (s scenario) setUp() (gameVersion, error) {
+	version, ok := findGameVersion(s.Version)
+	if !ok {
+		return version, fmt.Errorf("Unknown version '%s'", s.Version)
+	}
+	if len(s.Players) < 2 {
+		return version, fmt.Errorf("A scenario needs at least 2 players")
+	}
+
+	if err := version.Init(); err != nil {
+		return version, err
+	}
+
+	if s.Market != nil {
+		var cards []*supplyCard
+		for _, card := range market.Cards {
+			count, ok := s.Market[card.Name]
+			if !ok {
+				continue
+			}
+			card.Supply = count
+			cards = append(cards, card)
+		}
+		for name := range s.Market {
+			if _, ok := findByName(market.Cards, name); !ok {
+				return version, fmt.Errorf("Market has unknown card '%s'", name)
+			}
+		}
+		market.Market = newBasicMarketManager(cards)
+	}
+
+	plrs = nil
+	for i, sp := range s.Players {
+		p := newPlayer(i, sp.Coins, nil)
+		bank.TransferTo(sp.Investment, &p.Investment)
+
+		for name, count := range sp.Cards {
+			if _, ok := findByName(market.Cards, name); !ok {
+				return version, fmt.Errorf("Player %d has unknown card '%s'", i, name)
+			}
+			closed := sp.Closed[name]
+			if closed > count {
+				return version, fmt.Errorf("Player %d has more closed %s cards than cards", i, name)
+			}
+			pc := &playerCard{}
+			for j := 0; j < count; j++ {
+				pc.Add(j < closed)
+			}
+			p.SupplyCards[name] = pc
+		}
+
+		for _, name := range sp.Landmarks {
+			if _, ok := p.LandmarkCards[name]; !ok {
+				return version, fmt.Errorf("Player %d has unknown landmark '%s'", i, name)
+			}
+			p.LandmarkCards[name] = true
+			market.PurchaseLandmark(name)
+		}
+
+		plrs = append(plrs, p)
+	}
+
+	return version, nil
+}
+
+// forceRolls makes the dice roll the given dice, in order.
+func forceRolls(rolls [][]int) {
+	dice := &scriptedDice{Faces: diceFaces(gameDice), rolls: rolls}
+	rollDice = func(dieCount int) []int {
+		faces, err := dice.next(dieCount)
+		if err != nil {
+			panic(scenarioAbort{Reason: err.Error()})
+		}
+
+		return faces
+	}
+}
+
+// run plays the turns of the scenario and returns the differences from the
+// expected state.
+func (s scenario) run() (diffs []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch abort := r.(type) {
+			case scenarioAbort:
+				err = fmt.Errorf("%s", abort.Reason)
+			case gameQuit:
+				err = fmt.Errorf("The scenario quit the game")
+			default:
+				panic(r)
+			}
+		}
+	}()
+
+	// Markets are laid out randomly, a fixed seed makes the runs repeatable.
+	rand.Seed(1)
+
+	version, err := s.setUp()
+	if err != nil {
+		return nil, err
+	}
+
+	var winner *int
+	for i, st := range s.Turns {
+		if st.Roller < 0 || st.Roller >= len(plrs) {
+			return nil, fmt.Errorf("Turn %d has unknown roller %d", i+1, st.Roller)
+		}
+
+		forceRolls(st.Rolls)
+		specialRoll := st.SpecialRoll
+		rollSpecial = func() int {
+			return specialRoll
+		}
+		input = &scriptedInput{r: strings.NewReader(strings.Join(st.Decisions, "\n") + "\n")}
+		pushedLines = nil
+
+		rlr := plrs[st.Roller]
+		if _, won := takeTurn(version, rlr); won {
+			id := rlr.ID
+			winner = &id
+			break
+		}
+	}
+
+	return s.Expect.diff(winner), nil
+}
+
+func (e scenarioExpection) diff(winner *int) []string {
+	var diffs []string
+
+	for i, expected := range e.Players {
+		if expected == nil {
+			continue
+		}
+		if i >= len(plrs) {
+			diffs = append(diffs, fmt.Sprintf("Player %d does not exist", i))
+			continue
+		}
+		diffs = append(diffs, expected.diff(plrs[i])...)
+	}
+
+	if e.Market != nil {
+		left := make(map[string]int)
+		for _, cardCount := range market.EachCard() {
+			left[cardCount.Card.Name] += cardCount.Count
+		}
+		for _, name := range sortedKeys(e.Market) {
+			if left[name] != e.Market[name] {
+				diffs = append(diffs, fmt.Sprintf("Market has %d %s cards, expected %d", left[name], name, e.Market[name]))
+			}
+		}
+	}
+
+	if e.Winner != nil {
+		if winner == nil {
+			diffs = append(diffs, fmt.Sprintf("Nobody won, expected player %d", *e.Winner))
+		} else if *winner != *e.Winner {
+			diffs = append(diffs, fmt.Sprintf("Player %d won, expected player %d", *winner, *e.Winner))
+		}
+	} else if winner != nil {
+		diffs = append(diffs, fmt.Sprintf("Player %d won unexpectedly", *winner))
+	}
+
+	return diffs
+}
+
+func (e scenarioPlayer) diff(p *player) []string {
+	var diffs []string
+
+	if coins := p.Coins.Total(); coins != e.Coins {
+		diffs = append(diffs, fmt.Sprintf("Player %d has %d coins, expected %d", p.ID, coins, e.Coins))
+	}
+	if investment := p.Investment.Total(); investment != e.Investment {
+		diffs = append(diffs, fmt.Sprintf("Player %d has invested %d coins, expected %d", p.ID, investment, e.Investment))
+	}
+
+	if e.Cards != nil {
+		names := make(map[string]int)
+		for name := range e.Cards {
+			names[name] = 0
+		}
+		for name := range p.SupplyCards {
+			names[name] = 0
+		}
+		for _, name := range sortedKeys(names) {
+			var total, closed int
+			if pc, ok := p.SupplyCards[name]; ok {
+				total = pc.Total
+				closed = pc.Renovation
+			}
+			if total != e.Cards[name] {
+				diffs = append(diffs, fmt.Sprintf("Player %d has %d %s cards, expected %d", p.ID, total, name, e.Cards[name]))
+			}
+			if closed != e.Closed[name] {
+				diffs = append(diffs, fmt.Sprintf("Player %d has %d closed %s cards, expected %d", p.ID, closed, name, e.Closed[name]))
+			}
+		}
+	}
+
+	if e.Landmarks != nil {
+		expected := make(map[string]bool)
+		for _, name := range e.Landmarks {
+			expected[name] = true
+		}
+		for _, landmark := range market.LandmarkCards {
+			built := p.LandmarkCards[landmark.Name]
+			// Landmarks that cost nothing are built from the start and don't
+			// have to be listed.
+			if built == expected[landmark.Name] || (built && landmark.CostFor(p) == 0) {
+				continue
+			}
+			if built {
+				diffs = append(diffs, fmt.Sprintf("Player %d has built %s, expected not", p.ID, landmark.Name))
+			} else {
+				diffs = append(diffs, fmt.Sprintf("Player %d has not built %s, expected built", p.ID, landmark.Name))
+			}
+		}
+	}
+
+	return diffs
+}
+
+func sortedKeys(m map[string]int) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// runScenario runs the scenario with the game output captured, so that it is
+// only shown when the scenario fails.
+func runScenario(s scenario) ([]string, string, error) {
+	restore := saveGlobals()
+	defer restore()
+
+	var log bytes.Buffer
+	output = &log
+
+	diffs, err := s.run()
+
+	return diffs, log.String(), err
+}
+
+func runScenarios(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("Usage: scenarios <directory>")
+	}
+
+	presets, err := loadVersionPresets()
+	if err != nil {
+		fmt.Fprintln(output, err)
+	}
+	for _, preset := range presets {
+		registerGameVersion(preset.GameVersion())
+	}
+
+	paths, err := filepath.Glob(filepath.Join(args[0], "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("There are no scenarios in %s", args[0])
+	}
+
+	failed := 0
+	for _, path := range paths {
+		s, err := loadScenario(path)
+		if err != nil {
+			fmt.Fprintf(output, "FAIL %s: %s\n", path, err)
+			failed++
+			continue
+		}
+
+		diffs, log, err := runScenario(s)
+		if err == nil && len(diffs) == 0 {
+			fmt.Fprintf(output, "PASS %s\n", s.Name)
+			continue
+		}
+
+		failed++
+		fmt.Fprintf(output, "FAIL %s\n", s.Name)
+		if err != nil {
+			fmt.Fprintf(output, "  %s\n", err)
+		}
+		for _, diff := range diffs {
+			fmt.Fprintf(output, "  %s\n", diff)
+		}
+		if log = strings.TrimRight(log, "\n"); log != "" {
+			for _, line := range strings.Split(log, "\n") {
+				fmt.Fprintf(output, "    | %s\n", line)
+			}
+		}
+	}
+
+	fmt.Fprintf(output, "%d passed, %d failed\n", len(paths)-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d scenarios failed", failed)
+	}
+
+	return nil
+}
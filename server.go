@@ -0,0 +1,826 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The game server hosts games over HTTP. Every game is played by its own
+// engine, a process of this program speaking the JSON-lines protocol, which
+// is managed by its own goroutine and guarded by its own lock.
+//
+//   POST /games                      {"version": "Basic", "seats": [{}, {"bot": "easy"}],
+//                                     "clock": "10m+5s", "spectator_delay": "10"}
+//   POST /games/<id>/join            {"seat": 0, "name": "Ann"}, answers with the token of the seat
+//   GET  /games/<id>                 the state of the game and the open decision
+//   POST /games/<id>/decisions       {"id": 3, "value": 1}, with "Authorization: Bearer <token>"
+//   GET  /games/<id>/events?after=N  the events after the Nth, waits for new ones
+//   GET  /games/<id>/ws?token=<token> a WebSocket of the game, see stream
+//   GET  /lobby                      the versions, the bots, the games and card colors
+//   GET  /                           the browser client
+//
+// Seats are empty for players, or name one of the bots the server was started
+// with.
+
+const (
+	defaultServerAddr = ":8080"
+	// longPollTimeout is how long a request for events waits for new events.
+	longPollTimeout = 30 * time.Second
+)
+
+type gameServer struct {
+	Bots map[string]string
+	// Grace is how long games wait for players who lost their connection,
+	// and Takeover is the bot that plays for them after that.
+	Grace    time.Duration
+	Takeover string
+
+	mu     sync.Mutex
+	games  map[string]*serverGame
+	lastID int
+}
+
+type serverSeat struct {
+	Bot    string `json:"bot,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Joined bool   `json:"joined"`
+	// Connected tells if the player of the seat has a connection to the
+	// game, and Away if the seat is played for them.
+	Connected bool `json:"connected"`
+	Away      bool `json:"away"`
+
+	token       string
+	connections int
+	remote      bool
+	grace       *time.Timer
+	takeover    *botPlayer
+	botSent     int
+	deciding    bool
+}
+
+// serverEvent is a line of text of the game, or a turn or a roll of the
+// engine.
+type serverEvent struct {
+	Index int    `json:"index"`
+	Type  string `json:"type"`
+	Text  string `json:"text,omitempty"`
+	Seat  *int   `json:"seat,omitempty"`
+	Dice  []int  `json:"dice,omitempty"`
+	Total int    `json:"total,omitempty"`
+	at    time.Time
+}
+
+func (e serverEvent) message() jsonlMessage {
+	return jsonlMessage{Type: e.Type, ID: e.Index, Text: e.Text, Seat: e.Seat, Dice: e.Dice, Total: e.Total}
+}
+
+// serverGame is a game and its engine. All fields are guarded by the lock.
+type serverGame struct {
+	ID      string
+	Version string
+
+	mu       sync.Mutex
+	seats    []*serverSeat
+	events   []serverEvent
+	decision *jsonlMessage
+	state    *gameState
+	result   string
+	changed  chan struct{}
+	engine   *exec.Cmd
+	toEngine io.WriteCloser
+
+	grace       time.Duration
+	takeoverBot string
+	clock       *gameClock
+
+	spectators     int
+	spectatorDelay *spectatorDelay
+	history        []delayedDecision
+}
+
+// gameOptions are the optional rules of a hosted game.
+type gameOptions struct {
+	Clock          *timeControl
+	SpectatorDelay *spectatorDelay
+}
+
+// engineMessage is a line written by an engine. It has the fields of a
+// jsonlMessage, which can't be read into because of its embedded pointer.
+type engineMessage struct {
+	Type   string     `json:"type"`
+	ID     int        `json:"id"`
+	Text   string     `json:"text"`
+	Seat   *int       `json:"seat"`
+	Dice   []int      `json:"dice"`
+	Total  int        `json:"total"`
+	State  *gameState `json:"state"`
+	Result string     `json:"result"`
+	decisionRequest
+}
+
+type createGameRequest struct {
+	Version string       `json:"version"`
+	Seats   []serverSeat `json:"seats"`
+	// Clock is the time control, like "30s" for each decision or "10m+5s"
+	// for a bank of time with an increment each turn.
+	Clock string `json:"clock"`
+	// SpectatorDelay is how far spectators are behind, like "10" events or
+	// "30s".
+	SpectatorDelay string `json:"spectator_delay"`
+}
+
+type gameStatus struct {
+	ID       string        `json:"id"`
+	Version  string        `json:"version"`
+	Seats    []*serverSeat `json:"seats"`
+	State    *gameState    `json:"state,omitempty"`
+	Decision *jsonlMessage `json:"decision,omitempty"`
+	Events   int           `json:"events"`
+	Clock    *clockStatus  `json:"clock,omitempty"`
+	Result   string        `json:"result,omitempty"`
+
+	Spectators     int    `json:"spectators"`
+	SpectatorDelay string `json:"spectator_delay,omitempty"`
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+func runServe(args []string) error {
+	var bots botFlags
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", defaultServerAddr, "The address to listen on")
+	flags.Var(&bots, "bot", "A bot that seats can use, like easy=./mybot (can be repeated)")
+	grace := flags.Duration("grace", defaultGracePeriod, "How long a game waits for a player who lost the connection")
+	takeover := flags.String("takeover", "", "The bot that plays for players who don't come back in time")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	s, err := newGameServer(bots, *grace, *takeover)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(output, "Serving games on %s\n", *addr)
+
+	return http.ListenAndServe(*addr, s)
+}
+
+// newGameServer makes a server with the bots of the --bot flags, which name
+// the commands of the bots like easy=./mybot. It registers the presets, so
+// that games can be created for them.
+func newGameServer(bots botFlags, grace time.Duration, takeover string) (*gameServer, error) {
+	s := &gameServer{
+		Bots:     make(map[string]string),
+		Grace:    grace,
+		Takeover: takeover,
+		games:    make(map[string]*serverGame),
+	}
+	for _, bot := range bots {
+		parts := strings.SplitN(bot, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid bot '%s', use <name>=<command>", bot)
+		}
+		s.Bots[parts[0]] = parts[1]
+	}
+	if _, ok := s.Bots[takeover]; takeover != "" && !ok {
+		return nil, fmt.Errorf("Unknown takeover bot '%s'", takeover)
+	}
+
+	presets, err := loadVersionPresets()
+	if err != nil {
+		fmt.Fprintln(output, err)
+	}
+	for _, preset := range presets {
+		registerGameVersion(preset.GameVersion())
+	}
+
+	return s, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (s *gameServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, webClientHTML)
+		return
+	case parts[0] == "lobby" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.lobby())
+		return
+	case parts[0] != "games":
+		writeError(w, http.StatusNotFound, errors.New("Not found"))
+		return
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		s.createGame(w, r)
+		return
+	case len(parts) == 1:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Use POST to create a game"))
+		return
+	}
+
+	g, ok := s.game(parts[1])
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("Unknown game '%s'", parts[1]))
+		return
+	}
+
+	action := ""
+	if len(parts) > 2 {
+		action = parts[2]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, g.statusFor(bearerToken(r)))
+	case action == "join" && r.Method == http.MethodPost:
+		g.join(w, r)
+	case action == "decisions" && r.Method == http.MethodPost:
+		g.decide(w, r)
+	case action == "events" && r.Method == http.MethodGet:
+		g.pollEvents(w, r)
+	case action == "ws" && r.Method == http.MethodGet:
+		g.stream(w, r)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("Not found"))
+	}
+}
+
+// lobby lists what is needed to create and join games: the versions, the
+// bots and the games, and the colors of the cards for drawing them.
+func (s *gameServer) lobby() map[string]interface{} {
+	var versions []string
+	for _, version := range gameVersionsSorted {
+		versions = append(versions, version.Name)
+	}
+	var bots []string
+	for name := range s.Bots {
+		bots = append(bots, name)
+	}
+	sort.Strings(bots)
+
+	s.mu.Lock()
+	var games []*serverGame
+	for _, g := range s.games {
+		games = append(games, g)
+	}
+	s.mu.Unlock()
+	sort.Slice(games, func(i, j int) bool {
+		a, _ := strconv.Atoi(games[i].ID)
+		b, _ := strconv.Atoi(games[j].ID)
+		return a < b
+	})
+
+	statuses := []gameStatus{}
+	for _, g := range games {
+		status := g.status()
+		status.State = nil
+		status.Decision = nil
+		statuses = append(statuses, status)
+	}
+
+	colors := make(map[string]string)
+	for _, set := range append(cardSetsSorted, cardSet{Cards: machiKoro2SupplyCards}) {
+		for _, card := range set.Cards {
+			colors[card.Name] = card.Color.String()
+		}
+	}
+
+	return map[string]interface{}{"versions": versions, "bots": bots, "colors": colors, "games": statuses}
+}
+
+func (s *gameServer) createGame(w http.ResponseWriter, r *http.Request) {
+	var req createGameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var options gameOptions
+	var err error
+	if options.Clock, err = parseTimeControl(req.Clock); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if options.SpectatorDelay, err = parseSpectatorDelay(req.SpectatorDelay); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	g, err := s.newGame(req.Version, req.Seats, options)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, g.status())
+}
+
+// newGame creates a game and starts its engine.
+func (s *gameServer) newGame(version string, seats []serverSeat, options gameOptions) (*serverGame, error) {
+	if _, ok := findGameVersion(version); !ok {
+		return nil, fmt.Errorf("Unknown version '%s'", version)
+	}
+	if len(seats) < 2 || len(seats) > 4 {
+		return nil, errors.New("A game is for 2-4 seats")
+	}
+
+	var engineArgs []string
+	engineArgs = append(engineArgs, "--protocol="+jsonlProtocol)
+
+	g := &serverGame{
+		Version:        version,
+		changed:        make(chan struct{}),
+		grace:          s.Grace,
+		takeoverBot:    s.Bots[s.Takeover],
+		spectatorDelay: options.SpectatorDelay,
+	}
+	for i, seat := range seats {
+		if seat.Bot != "" {
+			command, ok := s.Bots[seat.Bot]
+			if !ok {
+				return nil, fmt.Errorf("Unknown bot '%s'", seat.Bot)
+			}
+			engineArgs = append(engineArgs, fmt.Sprintf("--bot=%d=%s", i, command))
+		}
+		g.seats = append(g.seats, &serverSeat{Bot: seat.Bot, Joined: seat.Bot != ""})
+	}
+	if options.Clock != nil {
+		g.clock = newGameClock(*options.Clock, len(seats))
+	}
+
+	s.mu.Lock()
+	s.lastID++
+	g.ID = strconv.Itoa(s.lastID)
+	s.games[g.ID] = g
+	s.mu.Unlock()
+
+	if err := g.start(engineArgs); err != nil {
+		s.mu.Lock()
+		delete(s.games, g.ID)
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// game finds the game with the id.
+func (s *gameServer) game(id string) (*serverGame, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.games[id]
+
+	return g, ok
+}
+
+// start runs the engine of the game and the goroutine that reads it.
+func (g *serverGame) start(args []string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	g.engine = exec.Command(executable, args...)
+	g.engine.Stderr = os.Stderr
+	g.toEngine, err = g.engine.StdinPipe()
+	if err != nil {
+		return err
+	}
+	fromEngine, err := g.engine.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = g.engine.Start(); err != nil {
+		return err
+	}
+
+	go g.run(fromEngine)
+
+	return nil
+}
+
+func (g *serverGame) run(fromEngine io.Reader) {
+	scanner := bufio.NewScanner(fromEngine)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var msg engineMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.Printf("Game %s: invalid engine output: %s", g.ID, err)
+			continue
+		}
+
+		g.mu.Lock()
+		switch msg.Type {
+		case "event":
+			g.addEvent(msg.Text)
+		case turnAnnouncement, rollAnnouncement:
+			if msg.Type == turnAnnouncement && msg.Seat != nil {
+				g.startTurnClock(*msg.Seat)
+			}
+			g.appendEvent(serverEvent{Type: msg.Type, Seat: msg.Seat, Dice: msg.Dice, Total: msg.Total})
+		case "decision":
+			req := msg.decisionRequest
+			g.state = msg.State
+			g.decision = &jsonlMessage{Type: msg.Type, ID: msg.ID, Seat: msg.Seat, decisionRequest: &req}
+			if msg.Seat != nil && *msg.Seat == -1 {
+				g.answerSetup(*g.decision)
+			}
+			g.startClock()
+			g.recordDecision()
+			g.decideForAway()
+			g.waitForAbsent()
+		case "end":
+			g.result = msg.Result
+			g.decision = nil
+			g.stopClock()
+			g.endTakeovers()
+		}
+		g.notify()
+		g.mu.Unlock()
+	}
+
+	g.engine.Wait()
+
+	g.mu.Lock()
+	if g.result == "" {
+		g.result = "The engine stopped"
+	}
+	g.decision = nil
+	g.stopClock()
+	g.endTakeovers()
+	g.notify()
+	g.mu.Unlock()
+}
+
+// answerSetup makes the decisions about the game itself, which were made
+// when the game was created.
+func (g *serverGame) answerSetup(msg jsonlMessage) {
+	var value interface{}
+
+	switch {
+	case strings.HasPrefix(msg.Prompt, "How many players"):
+		value = len(g.seats)
+	case strings.HasPrefix(msg.Prompt, "Which version"):
+		value = g.Version
+	default:
+		value = nil
+	}
+
+	g.send(msg.ID, value)
+}
+
+func (g *serverGame) send(id int, value interface{}) {
+	line, _ := json.Marshal(jsonlDecision{ID: id, Value: value})
+	g.stopClock()
+	g.decision = nil
+	fmt.Fprintf(g.toEngine, "%s\n", line)
+}
+
+// addEvent adds an event of the engine or of the server to the game. It is
+// called with the lock held.
+func (g *serverGame) addEvent(text string) {
+	g.appendEvent(serverEvent{Type: "event", Text: text})
+}
+
+// appendEvent numbers the event and adds it to the game. It is called with
+// the lock held.
+func (g *serverGame) appendEvent(event serverEvent) {
+	event.Index = len(g.events) + 1
+	event.at = time.Now()
+	g.events = append(g.events, event)
+	g.notify()
+}
+
+// notify wakes up the requests waiting for events. It is called with the
+// lock held.
+func (g *serverGame) notify() {
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+func (g *serverGame) status() gameStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var seats []*serverSeat
+	for _, seat := range g.seats {
+		seats = append(seats, &serverSeat{
+			Bot:       seat.Bot,
+			Name:      seat.Name,
+			Joined:    seat.Joined,
+			Connected: seat.connections > 0,
+			Away:      seat.Away,
+		})
+	}
+
+	status := gameStatus{
+		ID:         g.ID,
+		Version:    g.Version,
+		Seats:      seats,
+		State:      g.state,
+		Decision:   g.decision,
+		Events:     len(g.events),
+		Clock:      g.clockStatus(),
+		Result:     g.result,
+		Spectators: g.spectators,
+	}
+	if g.spectatorDelay != nil {
+		status.SpectatorDelay = g.spectatorDelay.String()
+	}
+
+	return status
+}
+
+// statusFor is the status as the holder of the token can see it. Without the
+// token of a seat the current state is hidden while spectators are delayed.
+func (g *serverGame) statusFor(token string) gameStatus {
+	status := g.status()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.spectatorDelay != nil && g.seatOf(token) == -1 && g.result == "" {
+		status.State = nil
+		status.Decision = nil
+		status.Events, _ = g.releasedEvents()
+	}
+
+	return status
+}
+
+func (g *serverGame) join(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Seat int    `json:"seat"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	token, err := g.joinSeat(req.Seat, req.Name)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"seat": req.Seat, "token": token})
+}
+
+// joinSeat takes the seat for a player, and returns the token of the seat.
+func (g *serverGame) joinSeat(i int, name string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if i < 0 || i >= len(g.seats) {
+		return "", fmt.Errorf("Unknown seat %d", i)
+	}
+	seat := g.seats[i]
+	if seat.Joined {
+		return "", fmt.Errorf("Seat %d is taken", i)
+	}
+
+	seat.Joined = true
+	seat.Name = name
+	seat.token = newToken()
+
+	return seat.token, nil
+}
+
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// seatOf is the seat of the token, or -1.
+func (g *serverGame) seatOf(token string) int {
+	if token == "" {
+		return -1
+	}
+
+	for i, seat := range g.seats {
+		if seat.token == token {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (g *serverGame) decide(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 64*1024))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, status, err := g.submitDecision(bearerToken(r), body)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	writeJSON(w, status, map[string]int{"id": id})
+}
+
+// submitDecision sends the decision of the seat with the token to the engine,
+// if it is a legal decision for the open request. It returns the id of the
+// decision and the status of the answer.
+func (g *serverGame) submitDecision(token string, body []byte) (int, int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	seat := g.seatOf(token)
+	if seat == -1 {
+		return 0, http.StatusUnauthorized, errors.New("Join a seat and send its token")
+	}
+	g.present(seat)
+	if g.decision == nil || g.decision.Seat == nil || *g.decision.Seat != seat {
+		return 0, http.StatusConflict, errors.New("It is not your decision")
+	}
+
+	var decision jsonlDecision
+	if err := json.Unmarshal(body, &decision); err != nil {
+		return 0, http.StatusBadRequest, err
+	}
+	if decision.ID == 0 {
+		return 0, http.StatusBadRequest, errors.New("The decision needs the id of the request")
+	}
+	if _, err := parseJSONLDecision(*g.decision.decisionRequest, g.decision.ID, string(body)); err != nil {
+		return 0, http.StatusBadRequest, err
+	}
+
+	g.send(decision.ID, decision.Value)
+
+	return decision.ID, http.StatusAccepted, nil
+}
+
+func (g *serverGame) pollEvents(w http.ResponseWriter, r *http.Request) {
+	after, _ := strconv.Atoi(r.URL.Query().Get("after"))
+	timeout := time.After(longPollTimeout)
+	token := bearerToken(r)
+
+	for {
+		g.mu.Lock()
+		if after < 0 {
+			after = 0
+		}
+		// Spectators only get the events they are allowed to see.
+		released, wake := len(g.events), time.Duration(-1)
+		if seat := g.seatOf(token); seat == -1 {
+			released, wake = g.releasedEvents()
+		} else {
+			g.present(seat)
+		}
+		if after < released || (g.result != "" && released == len(g.events)) {
+			var events []serverEvent
+			if after < released {
+				events = append(events, g.events[after:released]...)
+			}
+			g.mu.Unlock()
+			writeJSON(w, http.StatusOK, map[string]interface{}{"events": events})
+			return
+		}
+		changed := g.changed
+		g.mu.Unlock()
+
+		var timer <-chan time.Time
+		if wake >= 0 {
+			timer = time.After(wake)
+		}
+		select {
+		case <-changed:
+		case <-timer:
+		case <-timeout:
+			writeJSON(w, http.StatusOK, map[string]interface{}{"events": []serverEvent{}})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// stream pushes the game to a WebSocket as it happens: the events, the open
+// decision with the state of the game and the end. Players connect with the
+// token of their seat and send decisions like {"id": 3, "value": 1} on it,
+// spectators connect without a token and get the game with its delay.
+func (g *serverGame) stream(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebsocket(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer ws.Close()
+
+	token := r.URL.Query().Get("token")
+	g.mu.Lock()
+	seat := g.seatOf(token)
+	g.mu.Unlock()
+	if seat != -1 {
+		g.connect(seat)
+		defer g.disconnect(seat)
+	}
+
+	hello, _ := json.Marshal(map[string]interface{}{"type": "hello", "seat": seat, "game": g.statusFor(token)})
+	if ws.WriteText(hello) != nil {
+		return
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if _, _, err := g.submitDecision(token, msg); err != nil {
+				reply, _ := json.Marshal(jsonlMessage{Type: "error", Text: err.Error()})
+				ws.WriteText(reply)
+			}
+		}
+	}()
+
+	send := func(msg jsonlMessage) error {
+		line, _ := json.Marshal(msg)
+		return ws.WriteText(line)
+	}
+	if seat == -1 {
+		g.watch(closed, send)
+		return
+	}
+	g.follow(closed, send)
+}
+
+// follow sends the messages of the game as it happens: the events, the open
+// decision with the state of the game and finally the end. It stops when
+// sending fails or stop is closed.
+func (g *serverGame) follow(stop <-chan struct{}, send func(msg jsonlMessage) error) {
+	sent := 0
+	lastDecision := 0
+	for {
+		var messages []jsonlMessage
+
+		g.mu.Lock()
+		for _, event := range g.events[sent:] {
+			messages = append(messages, event.message())
+		}
+		sent = len(g.events)
+		if g.decision != nil && g.decision.ID != lastDecision {
+			msg := *g.decision
+			msg.State = g.state
+			msg.Clock = g.clockStatus()
+			messages = append(messages, msg)
+			lastDecision = msg.ID
+		}
+		if g.result != "" {
+			messages = append(messages, jsonlMessage{Type: "end", Result: g.result})
+		}
+		changed := g.changed
+		g.mu.Unlock()
+
+		for _, msg := range messages {
+			if send(msg) != nil || msg.Type == "end" {
+				return
+			}
+		}
+
+		select {
+		case <-changed:
+		case <-stop:
+			return
+		}
+	}
+}
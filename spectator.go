@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spectators of the game server see the events and the state of a game but
+// can't make decisions. A game can delay what spectators see by a number of
+// events or by a time, so that they can't coach the players. Everyone at the
+// game is told when spectators come and go.
+
+type spectatorDelay struct {
+	Events   int
+	Duration time.Duration
+}
+
+// parseSpectatorDelay reads "10" as a delay of 10 events and "30s" as a delay
+// of 30 seconds. An empty spec is no delay.
+func parseSpectatorDelay(spec string) (*spectatorDelay, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	if n, err := strconv.Atoi(spec); err == nil && n >= 0 {
+		return &spectatorDelay{Events: n}, nil
+	}
+	if d, err := time.ParseDuration(spec); err == nil && d >= 0 {
+		return &spectatorDelay{Duration: d}, nil
+	}
+
+	return nil, errors.New("Invalid spectator delay '" + spec + "', use a number of events like 10 or a time like 30s")
+}
+
+func (d spectatorDelay) String() string {
+	if d.Duration > 0 {
+		return d.Duration.String()
+	}
+
+	return fmt.Sprintf("%d events", d.Events)
+}
+
+// delayedDecision is a decision as spectators see it, at its place among the
+// events.
+type delayedDecision struct {
+	events int
+	at     time.Time
+	msg    jsonlMessage
+}
+
+// watch follows the game for a spectator, with the delay of the game.
+func (g *serverGame) watch(stop <-chan struct{}, send func(msg jsonlMessage) error) {
+	g.mu.Lock()
+	g.spectators++
+	g.addEvent(fmt.Sprintf("A spectator is watching, %d in total.", g.spectators))
+	delay := g.spectatorDelay
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		g.spectators--
+		if g.result == "" {
+			g.addEvent(fmt.Sprintf("A spectator left, %d watching.", g.spectators))
+		}
+		g.mu.Unlock()
+	}()
+
+	if delay == nil {
+		g.follow(stop, send)
+		return
+	}
+	g.followDelayed(stop, send)
+}
+
+// releasedEvents is the number of events spectators can see, and how long
+// until the next event can be seen, or -1. It is called with the lock held.
+func (g *serverGame) releasedEvents() (int, time.Duration) {
+	delay := g.spectatorDelay
+	if delay == nil {
+		return len(g.events), -1
+	}
+
+	if delay.Duration > 0 {
+		cutoff := time.Now().Add(-delay.Duration)
+		released := sort.Search(len(g.events), func(i int) bool {
+			return g.events[i].at.After(cutoff)
+		})
+		if released < len(g.events) {
+			return released, g.events[released].at.Sub(cutoff)
+		}
+		return released, -1
+	}
+
+	// At the end of the game there is nothing left to coach.
+	if g.result != "" {
+		return len(g.events), -1
+	}
+	released := len(g.events) - delay.Events
+	if released < 0 {
+		released = 0
+	}
+
+	return released, -1
+}
+
+// followDelayed is follow with the delay of the game: the events and the
+// decisions are sent once they are old enough.
+func (g *serverGame) followDelayed(stop <-chan struct{}, send func(msg jsonlMessage) error) {
+	sentEvents := 0
+	sentDecisions := 0
+	for {
+		var messages []jsonlMessage
+
+		g.mu.Lock()
+		released, wake := g.releasedEvents()
+		cutoff := time.Now().Add(-g.spectatorDelay.Duration)
+		for {
+			if sentDecisions < len(g.history) {
+				d := g.history[sentDecisions]
+				if d.events <= sentEvents && !d.at.After(cutoff) && d.events <= released {
+					messages = append(messages, d.msg)
+					sentDecisions++
+					continue
+				}
+			}
+			if sentEvents >= released {
+				break
+			}
+			event := g.events[sentEvents]
+			messages = append(messages, event.message())
+			sentEvents++
+		}
+		if sentDecisions < len(g.history) {
+			if next := g.history[sentDecisions].at.Sub(cutoff); next > 0 && (wake < 0 || next < wake) {
+				wake = next
+			}
+		}
+		if g.result != "" && sentEvents == len(g.events) {
+			messages = append(messages, jsonlMessage{Type: "end", Result: g.result})
+		}
+		changed := g.changed
+		g.mu.Unlock()
+
+		for _, msg := range messages {
+			if send(msg) != nil || msg.Type == "end" {
+				return
+			}
+		}
+
+		var timer <-chan time.Time
+		if wake >= 0 {
+			timer = time.After(wake)
+		}
+		select {
+		case <-changed:
+		case <-timer:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// recordDecision keeps the open decision for delayed spectators. It is called
+// with the lock held.
+func (g *serverGame) recordDecision() {
+	if g.spectatorDelay == nil || g.decision == nil {
+		return
+	}
+
+	msg := *g.decision
+	msg.State = g.state
+	g.history = append(g.history, delayedDecision{events: len(g.events), at: time.Now(), msg: msg})
+}
@@ -1,10 +1,129 @@
 package main
 
+import "fmt"
+
 type supplyCard struct {
 	Name          string
 	Cost          int
 	ActiveNumbers []int
 	Effect        effect
-	Icon          string
+	Icon          cardIcon
+	Color         cardColor
 	Supply        int
 }
+
+// cardIcon is the icon printed on an establishment. Effects that count
+// establishments by icon depend on it. The zero value is not a valid icon, so
+// a card without an icon is caught when its card set is loaded.
+type cardIcon int
+
+const (
+	unknownIcon cardIcon = iota
+	wheatIcon
+	cowIcon
+	breadIcon
+	cupIcon
+	gearIcon
+	factoryIcon
+	fruitIcon
+	majorIcon
+	boatIcon
+	suitcaseIcon
+)
+
+var cardIconNames = []string{
+	unknownIcon:  "Unknown",
+	wheatIcon:    "Wheat",
+	cowIcon:      "Cow",
+	breadIcon:    "Bread",
+	cupIcon:      "Cup",
+	gearIcon:     "Gear",
+	factoryIcon:  "Factory",
+	fruitIcon:    "Fruit",
+	majorIcon:    "Major",
+	boatIcon:     "Boat",
+	suitcaseIcon: "Suitcase",
+}
+
+func (i cardIcon) String() string {
+	if !i.Valid() {
+		return cardIconNames[unknownIcon]
+	}
+
+	return cardIconNames[i]
+}
+
+func (i cardIcon) Valid() bool {
+	return i > unknownIcon && int(i) < len(cardIconNames)
+}
+
+func parseCardIcon(name string) (cardIcon, error) {
+	for i, iconName := range cardIconNames {
+		if cardIcon(i).Valid() && iconName == name {
+			return cardIcon(i), nil
+		}
+	}
+
+	return unknownIcon, fmt.Errorf("Unknown icon '%s'", name)
+}
+
+// cardColor is the color of an establishment, which tells on whose turn it is
+// activated. Blue cards activate on anyone's turn, green cards on the owner's
+// turn, red cards on other players' turns and purple cards are the major
+// establishments that activate on the owner's turn.
+type cardColor int
+
+const (
+	unknownColor cardColor = iota
+	blueColor
+	greenColor
+	redColor
+	purpleColor
+)
+
+var cardColorNames = []string{
+	unknownColor: "Unknown",
+	blueColor:    "Blue",
+	greenColor:   "Green",
+	redColor:     "Red",
+	purpleColor:  "Purple",
+}
+
+func (c cardColor) String() string {
+	if !c.Valid() {
+		return cardColorNames[unknownColor]
+	}
+
+	return cardColorNames[c]
+}
+
+func (c cardColor) Valid() bool {
+	return c > unknownColor && int(c) < len(cardColorNames)
+}
+
+func parseCardColor(name string) (cardColor, error) {
+	for i, colorName := range cardColorNames {
+		if cardColor(i).Valid() && colorName == name {
+			return cardColor(i), nil
+		}
+	}
+
+	return unknownColor, fmt.Errorf("Unknown color '%s'", name)
+}
+
+// validateCards checks the card data that can't be checked by the compiler.
+func validateCards(cards []*supplyCard) error {
+	for _, card := range cards {
+		if !card.Icon.Valid() {
+			return fmt.Errorf("Card %s has an unknown icon", card.Name)
+		}
+		if !card.Color.Valid() {
+			return fmt.Errorf("Card %s has an unknown color", card.Name)
+		}
+		if len(card.ActiveNumbers) == 0 {
+			return fmt.Errorf("Card %s has no active numbers", card.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,679 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The TCP lobby lets players in terminals play with nc or telnet. After
+// choosing a name they can list, create, join and watch games, which are the
+// games of the game server. The prompts of a player's decisions are only sent
+// to the connection of that player, everyone at the game gets the events.
+
+const defaultTCPAddr = ":2323"
+
+const (
+	telnetIAC  = 255
+	telnetSB   = 250
+	telnetSE   = 240
+	telnetWILL = 251
+	telnetDONT = 254
+)
+
+type tcpLobby struct {
+	server *gameServer
+}
+
+// tcpClient is a connection to the lobby. Lines are read by their own
+// goroutine, so that a client can wait for a line and for the game at the
+// same time.
+type tcpClient struct {
+	Name string
+
+	conn  net.Conn
+	lines chan string
+	done  chan struct{}
+	mu    sync.Mutex
+}
+
+func runServeTCP(args []string) error {
+	var bots botFlags
+	flags := flag.NewFlagSet("serve-tcp", flag.ContinueOnError)
+	addr := flags.String("addr", defaultTCPAddr, "The address to listen on")
+	flags.Var(&bots, "bot", "A bot that seats can use, like easy=./mybot (can be repeated)")
+	grace := flags.Duration("grace", defaultGracePeriod, "How long a game waits for a player who lost the connection")
+	takeover := flags.String("takeover", "", "The bot that plays for players who don't come back in time")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	s, err := newGameServer(bots, *grace, *takeover)
+	if err != nil {
+		return err
+	}
+	lobby := &tcpLobby{server: s}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(output, "Serving the lobby on %s\n", *addr)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go lobby.serve(conn)
+	}
+}
+
+func newTCPClient(conn net.Conn) *tcpClient {
+	c := &tcpClient{
+		conn:  conn,
+		lines: make(chan string),
+		done:  make(chan struct{}),
+	}
+
+	go func() {
+		in := bufio.NewReader(conn)
+		for {
+			line, err := in.ReadString('\n')
+			if err != nil {
+				close(c.lines)
+				return
+			}
+			select {
+			case c.lines <- strings.TrimSpace(stripTelnet(line)):
+			case <-c.done:
+				return
+			}
+		}
+	}()
+
+	return c
+}
+
+// stripTelnet removes the option negotiation of telnet clients from a line.
+func stripTelnet(line string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(line); i++ {
+		if line[i] != telnetIAC {
+			b.WriteByte(line[i])
+			continue
+		}
+		if i+1 >= len(line) {
+			break
+		}
+		switch cmd := line[i+1]; {
+		case cmd == telnetSB:
+			end := strings.IndexByte(line[i:], telnetSE)
+			if end == -1 {
+				return b.String()
+			}
+			i += end
+		case cmd >= telnetWILL && cmd <= telnetDONT:
+			i += 2
+		default:
+			i++
+		}
+	}
+
+	return b.String()
+}
+
+// printf writes to the client, with the line endings of the network.
+func (c *tcpClient) printf(format string, a ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	text := strings.Replace(fmt.Sprintf(format, a...), "\n", "\r\n", -1)
+	c.conn.Write([]byte(text))
+}
+
+// ask prompts for a line. It reports false when the client is gone.
+func (c *tcpClient) ask(prompt string) (string, bool) {
+	c.printf("%s", prompt)
+	line, ok := <-c.lines
+
+	return line, ok
+}
+
+func (l *tcpLobby) serve(conn net.Conn) {
+	c := newTCPClient(conn)
+	defer func() {
+		close(c.done)
+		conn.Close()
+	}()
+
+	c.printf("Welcome to Machi Koro!\n")
+	for c.Name == "" {
+		name, ok := c.ask("What is your name? ")
+		if !ok {
+			return
+		}
+		c.Name = name
+	}
+	c.printf("Hello %s, type help for the commands.\n", c.Name)
+
+	for {
+		line, ok := c.ask("> ")
+		if !ok {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToLower(fields[0]) {
+		case "games", "list":
+			l.printGames(c)
+		case "new", "create":
+			if !l.create(c) {
+				return
+			}
+		case "join":
+			if !l.join(c, fields[1:]) {
+				return
+			}
+		case "watch":
+			if !l.watch(c, fields[1:]) {
+				return
+			}
+		case "resume":
+			if !l.resume(c, fields[1:]) {
+				return
+			}
+		case "help":
+			c.printf("Commands:\n")
+			c.printf("  games                  List the games\n")
+			c.printf("  new                    Create a game and play its first seat\n")
+			c.printf("  join <game> [seat]     Play a free seat of a game\n")
+			c.printf("  watch <game>           Watch a game\n")
+			c.printf("  resume <game> <token>  Play your seat again after leaving\n")
+			c.printf("  quit                   Leave the lobby\n")
+		case "quit":
+			c.printf("Bye!\n")
+			return
+		default:
+			c.printf("Unknown command '%s', type help for the commands.\n", fields[0])
+		}
+	}
+}
+
+func (l *tcpLobby) printGames(c *tcpClient) {
+	s := l.server
+	s.mu.Lock()
+	var games []*serverGame
+	for _, g := range s.games {
+		games = append(games, g)
+	}
+	s.mu.Unlock()
+	sort.Slice(games, func(i, j int) bool {
+		a, _ := strconv.Atoi(games[i].ID)
+		b, _ := strconv.Atoi(games[j].ID)
+		return a < b
+	})
+
+	if len(games) == 0 {
+		c.printf("There are no games yet, create one with new.\n")
+		return
+	}
+	for _, g := range games {
+		status := g.status()
+		var seats []string
+		for i, seat := range status.Seats {
+			switch {
+			case seat.Bot != "":
+				seats = append(seats, fmt.Sprintf("%d: bot %s", i, seat.Bot))
+			case seat.Joined:
+				seats = append(seats, fmt.Sprintf("%d: %s", i, seat.Name))
+			default:
+				seats = append(seats, fmt.Sprintf("%d: free", i))
+			}
+		}
+		result := ""
+		if status.Result != "" {
+			result = " (over)"
+		}
+		if status.Spectators > 0 {
+			seats = append(seats, fmt.Sprintf("%d watching", status.Spectators))
+		}
+		c.printf("  Game %s, %s%s: %s\n", status.ID, status.Version, result, strings.Join(seats, ", "))
+	}
+}
+
+// create asks for the version and the seats of a game, and plays the first
+// seat. It reports false when the client is gone.
+func (l *tcpLobby) create(c *tcpClient) bool {
+	var names []string
+	for i, version := range gameVersionsSorted {
+		names = append(names, version.Name)
+		c.printf("  (%d) %s\n", i+1, version.Name)
+	}
+
+	var version string
+	for version == "" {
+		line, ok := c.ask("Which version do you want to play? ")
+		if !ok {
+			return false
+		}
+		if n, err := strconv.Atoi(line); err == nil && n >= 1 && n <= len(names) {
+			version = names[n-1]
+			continue
+		}
+		idx, err := matchName(line, names)
+		if err != nil {
+			c.printf("%s, try again.\n", err)
+			continue
+		}
+		version = names[idx]
+	}
+
+	count := 0
+	for count == 0 {
+		line, ok := c.ask("How many players (2 - 4)? ")
+		if !ok {
+			return false
+		}
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 2 || n > 4 {
+			c.printf("Invalid input '%s', try again.\n", line)
+			continue
+		}
+		count = n
+	}
+
+	var bots []string
+	for name := range l.server.Bots {
+		bots = append(bots, name)
+	}
+	sort.Strings(bots)
+
+	seats := make([]serverSeat, count)
+	for i := 1; i < count && len(bots) > 0; i++ {
+		for {
+			line, ok := c.ask(fmt.Sprintf("Seat %d, a bot (%s) or empty for a player? ", i, strings.Join(bots, ", ")))
+			if !ok {
+				return false
+			}
+			if line == "" {
+				break
+			}
+			idx, err := matchName(line, bots)
+			if err != nil {
+				c.printf("%s, try again.\n", err)
+				continue
+			}
+			seats[i].Bot = bots[idx]
+			break
+		}
+	}
+
+	var control *timeControl
+	for {
+		line, ok := c.ask("Time control, like 30s per decision or 10m+5s, empty for none? ")
+		if !ok {
+			return false
+		}
+		var err error
+		if control, err = parseTimeControl(line); err != nil {
+			c.printf("%s\n", err)
+			continue
+		}
+		break
+	}
+
+	var delay *spectatorDelay
+	for {
+		line, ok := c.ask("Spectator delay, like 10 events or 30s, empty for none? ")
+		if !ok {
+			return false
+		}
+		var err error
+		if delay, err = parseSpectatorDelay(line); err != nil {
+			c.printf("%s\n", err)
+			continue
+		}
+		break
+	}
+
+	g, err := l.server.newGame(version, seats, gameOptions{Clock: control, SpectatorDelay: delay})
+	if err != nil {
+		c.printf("%s\n", err)
+		return true
+	}
+	c.printf("Created game %s.\n", g.ID)
+
+	return l.join(c, []string{g.ID, "0"})
+}
+
+// join plays the seat of the game, or the first free seat. It reports false
+// when the client is gone.
+func (l *tcpLobby) join(c *tcpClient, args []string) bool {
+	if len(args) == 0 {
+		c.printf("Which game? Use join <game> [seat].\n")
+		return true
+	}
+	g, ok := l.server.game(args[0])
+	if !ok {
+		c.printf("Unknown game '%s'\n", args[0])
+		return true
+	}
+
+	seat := -1
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			c.printf("Invalid seat '%s'\n", args[1])
+			return true
+		}
+		seat = n
+	} else {
+		for i, s := range g.status().Seats {
+			if !s.Joined {
+				seat = i
+				break
+			}
+		}
+		if seat == -1 {
+			c.printf("Game %s has no free seats.\n", g.ID)
+			return true
+		}
+	}
+
+	token, err := g.joinSeat(seat, c.Name)
+	if err != nil {
+		c.printf("%s\n", err)
+		return true
+	}
+	c.printf("You are player %d of game %s. Type help for the commands of the game.\n", seat, g.ID)
+	c.printf("If you lose the connection, come back with: resume %s %s\n", g.ID, token)
+
+	return l.play(c, g, seat, token)
+}
+
+// resume plays the seat of the token again. It reports false when the client
+// is gone.
+func (l *tcpLobby) resume(c *tcpClient, args []string) bool {
+	if len(args) != 2 {
+		c.printf("Use resume <game> <token>.\n")
+		return true
+	}
+	g, ok := l.server.game(args[0])
+	if !ok {
+		c.printf("Unknown game '%s'\n", args[0])
+		return true
+	}
+
+	g.mu.Lock()
+	seat := g.seatOf(args[1])
+	g.mu.Unlock()
+	if seat == -1 {
+		c.printf("The token is not for a seat of game %s.\n", g.ID)
+		return true
+	}
+	c.printf("You are back as player %d of game %s.\n", seat, g.ID)
+
+	return l.play(c, g, seat, args[1])
+}
+
+func (l *tcpLobby) watch(c *tcpClient, args []string) bool {
+	if len(args) == 0 {
+		c.printf("Which game? Use watch <game>.\n")
+		return true
+	}
+	g, ok := l.server.game(args[0])
+	if !ok {
+		c.printf("Unknown game '%s'\n", args[0])
+		return true
+	}
+	status := g.status()
+	if status.SpectatorDelay != "" {
+		c.printf("Watching game %s %s behind, type leave to go back to the lobby.\n", g.ID, status.SpectatorDelay)
+	} else {
+		c.printf("Watching game %s, type leave to go back to the lobby.\n", g.ID)
+	}
+
+	return l.play(c, g, -1, "")
+}
+
+// play follows the game for the client, and answers the decisions of the seat
+// with the lines of the client. Spectators have seat -1. It reports false when
+// the client is gone.
+func (l *tcpLobby) play(c *tcpClient, g *serverGame, seat int, token string) bool {
+	stop := make(chan struct{})
+	decisions := make(chan jsonlMessage)
+	ended := make(chan string, 1)
+	defer close(stop)
+	follow := g.watch
+	if seat != -1 {
+		follow = g.follow
+		g.connect(seat)
+		defer g.disconnect(seat)
+	}
+
+	go follow(stop, func(msg jsonlMessage) error {
+		switch msg.Type {
+		case "event":
+			c.printf("%s\n", msg.Text)
+		case "decision":
+			select {
+			case decisions <- msg:
+			case <-stop:
+				return errors.New("Stopped")
+			}
+		case "end":
+			ended <- msg.Result
+		}
+		return nil
+	})
+
+	var open *jsonlMessage
+	var state *gameState
+	// pushed is the name in "buy cheese", the answer to the next choice.
+	var pushed string
+
+	answer := func(line string) error {
+		value, next, err := lineDecision(*open.decisionRequest, line)
+		if err != nil {
+			return err
+		}
+		body, _ := json.Marshal(jsonlDecision{ID: open.ID, Value: value})
+		if _, _, err = g.submitDecision(token, body); err != nil {
+			return err
+		}
+		open = nil
+		pushed = next
+		return nil
+	}
+
+	for {
+		select {
+		case msg := <-decisions:
+			state = msg.State
+			if msg.Seat == nil || *msg.Seat != seat {
+				continue
+			}
+			open = &msg
+			if pushed != "" && msg.Kind == choiceDecision {
+				line := pushed
+				pushed = ""
+				err := answer(line)
+				if err == nil {
+					continue
+				}
+				c.printf("%s\n", err)
+			}
+			c.printf("%s ", tcpPrompt(*msg.decisionRequest, msg.Clock))
+		case result := <-ended:
+			if result == "won" {
+				c.printf("The game is over.\n")
+			} else {
+				c.printf("The game ended: %s\n", result)
+			}
+			return true
+		case line, ok := <-c.lines:
+			if !ok {
+				return false
+			}
+
+			switch strings.ToLower(line) {
+			case "leave":
+				c.printf("You left the game.\n")
+				return true
+			case "status":
+				printGameState(c, state)
+				continue
+			case "clock":
+				printClock(c, g)
+				continue
+			case "help":
+				c.printf("Answer the prompts by number or by name, like 'buy cheese'.\n")
+				c.printf("  status  Show the coins and cards of the players\n")
+				c.printf("  clock   Show the time the players have left\n")
+				c.printf("  leave   Go back to the lobby\n")
+				continue
+			}
+
+			if open == nil {
+				if seat == -1 {
+					c.printf("You are watching the game.\n")
+				} else {
+					c.printf("It is not your decision.\n")
+				}
+				continue
+			}
+			if err := answer(line); err != nil {
+				c.printf("%s, try again: ", err)
+			}
+		}
+	}
+}
+
+// tcpPrompt is the prompt of a decision as the text game shows it, with the
+// menu of the choices and the time left for the decision.
+func tcpPrompt(req decisionRequest, clock *clockStatus) string {
+	var lines []string
+	switch {
+	case len(req.Menu) > 0:
+		lines = req.Menu
+	case req.Kind == choiceDecision:
+		for _, choice := range req.Choices {
+			if choice.Label == "" {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("  (%d) %s", choice.Value, choice.Label))
+		}
+	}
+
+	prompt := req.Prompt
+	if req.Kind == boolDecision {
+		prompt += " (y/n)"
+	}
+	if clock != nil && clock.Seat != -1 {
+		prompt = fmt.Sprintf("[%s left] %s", formatSeconds(clock.Deadline), prompt)
+	}
+
+	return strings.Join(append(lines, prompt), "\n")
+}
+
+func formatSeconds(s float64) string {
+	return time.Duration(s * float64(time.Second)).Round(time.Second).String()
+}
+
+// printClock shows the time control of the game and the time of the players.
+func printClock(c *tcpClient, g *serverGame) {
+	g.mu.Lock()
+	clock := g.clockStatus()
+	g.mu.Unlock()
+
+	if clock == nil {
+		c.printf("The game has no time control.\n")
+		return
+	}
+
+	c.printf("Time control: %s\n", clock.Control)
+	for i, remaining := range clock.Remaining {
+		c.printf("  Player %d: %s\n", i, formatSeconds(remaining))
+	}
+	if clock.Seat != -1 {
+		c.printf("Player %d has %s for the decision.\n", clock.Seat, formatSeconds(clock.Deadline))
+	}
+}
+
+// lineDecision turns a line typed by a player into the value of the
+// decision. Choices can be named, and "buy cheese" answers yes and returns
+// "cheese" as the answer to the next choice.
+func lineDecision(req decisionRequest, line string) (interface{}, string, error) {
+	switch req.Kind {
+	case textDecision:
+		return line, "", nil
+	case boolDecision:
+		switch strings.ToLower(line) {
+		case "y", "yes":
+			return true, "", nil
+		case "n", "no":
+			return false, "", nil
+		}
+		for _, verb := range []string{"buy ", "build "} {
+			if strings.HasPrefix(strings.ToLower(line), verb) {
+				return true, strings.TrimSpace(line[len(verb):]), nil
+			}
+		}
+		return nil, "", fmt.Errorf("Invalid input '%s', answer y or n", line)
+	}
+
+	if line == "" {
+		if req.Optional {
+			return nil, "", nil
+		}
+		return nil, "", errors.New("A choice is needed")
+	}
+	if n, err := strconv.Atoi(line); err == nil {
+		return n, "", nil
+	}
+
+	var names []string
+	for _, choice := range req.Choices {
+		names = append(names, choice.Label)
+	}
+	idx, err := matchName(line, names)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return req.Choices[idx].Value, "", nil
+}
+
+// printGameState shows the coins, cards and landmarks of the players.
+func printGameState(c *tcpClient, state *gameState) {
+	if state == nil || len(state.Players) == 0 {
+		c.printf("The game has not started yet.\n")
+		return
+	}
+
+	for i, p := range state.Players {
+		var cards []string
+		for name, count := range p.Cards {
+			cards = append(cards, fmt.Sprintf("%s x%d", name, count))
+		}
+		sort.Strings(cards)
+		c.printf("Player %d: %d coins\n", i, p.Coins)
+		c.printf("  %s\n", strings.Join(cards, ", "))
+		if len(p.Landmarks) > 0 {
+			c.printf("  Landmarks: %s\n", strings.Join(p.Landmarks, ", "))
+		}
+	}
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// tui is a full-screen interface for a terminal. It is the input and output
+// of the game: what the game prints goes to the event log, and when the game
+// asks for an answer the screen is drawn and the keys are read into the
+// command area. Drawing only while the game waits for an answer means the
+// board is never read while the game changes it.
+type tui struct {
+	keys     *bufio.Reader
+	terminal io.Writer
+	state    string
+
+	log []string
+	// prompt is the last line of the output while it isn't finished, which
+	// is the question the game is asking.
+	prompt string
+	answer []byte
+	typed  []byte
+	scroll int
+	// request is the decision the game is asking for, which tells when a
+	// single key is a whole answer.
+	request decisionRequest
+
+	// The size of the terminal is read again when it changes. The screen is
+	// redrawn right away while the game waits for a key.
+	mu      sync.Mutex
+	rows    int
+	cols    int
+	waiting bool
+	resize  chan os.Signal
+}
+
+const (
+	ansiReset       = "\x1b[0m"
+	ansiBold        = "\x1b[1m"
+	ansiDim         = "\x1b[2m"
+	ansiClear       = "\x1b[H\x1b[2J"
+	ansiAltScreen   = "\x1b[?1049h"
+	ansiMainScreen  = "\x1b[?1049l"
+	tuiMinLogHeight = 3
+)
+
+var cardColorCodes = map[cardColor]string{
+	blueColor:   "\x1b[34m",
+	greenColor:  "\x1b[32m",
+	redColor:    "\x1b[31m",
+	purpleColor: "\x1b[35m",
+}
+
+var tuiColorOrder = []cardColor{blueColor, greenColor, redColor, purpleColor}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("The terminal UI needs a terminal with stty: %s", err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// newTUI switches the terminal to raw mode and to the alternate screen, so
+// that the screen before the game is restored by Close.
+func newTUI() (*tui, error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+
+	t := &tui{
+		keys:     bufio.NewReader(os.Stdin),
+		terminal: os.Stdout,
+		state:    state,
+		resize:   make(chan os.Signal, 1),
+	}
+	t.rows, t.cols = terminalSize()
+	notifyResize(t.resize)
+	go t.watchSize()
+	fmt.Fprint(t.terminal, ansiAltScreen)
+
+	return t, nil
+}
+
+func (t *tui) Close() {
+	stopResize(t.resize)
+	close(t.resize)
+	fmt.Fprint(t.terminal, ansiReset+ansiMainScreen)
+	stty(t.state)
+}
+
+// watchSize reads the size of the terminal each time it is resized.
+func (t *tui) watchSize() {
+	for range t.resize {
+		rows, cols := terminalSize()
+
+		t.mu.Lock()
+		t.rows, t.cols = rows, cols
+		if t.waiting {
+			t.draw()
+		}
+		t.mu.Unlock()
+	}
+}
+
+// readKey draws the screen and waits for a key.
+func (t *tui) readKey() (byte, error) {
+	t.mu.Lock()
+	t.waiting = true
+	t.draw()
+	t.mu.Unlock()
+
+	key, err := t.keys.ReadByte()
+
+	t.mu.Lock()
+	t.waiting = false
+	t.mu.Unlock()
+
+	return key, err
+}
+
+// Write adds the output of the game to the log.
+func (t *tui) Write(b []byte) (int, error) {
+	lines := strings.Split(t.prompt+string(b), "\n")
+	t.log = append(t.log, lines[:len(lines)-1]...)
+	t.prompt = lines[len(lines)-1]
+
+	return len(b), nil
+}
+
+// Read gives the game the answer typed into the command area, and asks for a
+// new one once the last answer is used up.
+func (t *tui) Read(b []byte) (int, error) {
+	if len(t.answer) == 0 {
+		t.answer = append(t.readAnswer(), '\n')
+	}
+
+	n := copy(b, t.answer)
+	t.answer = t.answer[n:]
+
+	return n, nil
+}
+
+// readAnswer reads keys until an answer is complete. The answer to a yes or
+// no question is complete with a single key, and so is a number that is the
+// only choice it can be the start of, like 2 to roll 2 dice.
+func (t *tui) readAnswer() []byte {
+	t.typed = nil
+
+	for {
+		key, err := t.readKey()
+		if err != nil {
+			panic(gameQuit{})
+		}
+
+		switch {
+		case key == 3 || key == 4:
+			panic(gameQuit{})
+		case key == '\r' || key == '\n':
+			return t.submit()
+		case key == 127 || key == 8:
+			if len(t.typed) > 0 {
+				t.typed = t.typed[:len(t.typed)-1]
+			}
+		case key == 27:
+			t.readEscape()
+		case key >= ' ' && key < 127:
+			t.typed = append(t.typed, key)
+			if len(t.typed) == 1 && (key == 'y' || key == 'n') && t.request.Kind == boolDecision {
+				return t.submit()
+			}
+			if t.request.Kind == choiceDecision && onlyChoice(t.request.Choices, string(t.typed)) {
+				return t.submit()
+			}
+		}
+	}
+}
+
+// onlyChoice reports if the typed number is a choice and no other choice
+// starts with it.
+func onlyChoice(choices []decisionChoice, typed string) bool {
+	if _, err := strconv.Atoi(typed); err != nil {
+		return false
+	}
+
+	found := false
+	for _, choice := range choices {
+		value := strconv.Itoa(choice.Value)
+		if value == typed {
+			found = true
+		} else if strings.HasPrefix(value, typed) {
+			return false
+		}
+	}
+
+	return found
+}
+
+func (t *tui) submit() []byte {
+	answer := t.typed
+	t.log = append(t.log, t.prompt+string(answer))
+	t.prompt = ""
+	t.typed = nil
+	t.scroll = 0
+
+	return answer
+}
+
+// readEscape reads the rest of an escape sequence. The arrow keys scroll the
+// log by a line and page up and page down by a page.
+func (t *tui) readEscape() {
+	if b, _ := t.keys.ReadByte(); b != '[' {
+		return
+	}
+
+	page := t.logHeight()
+	switch b, _ := t.keys.ReadByte(); b {
+	case 'A':
+		t.scroll++
+	case 'B':
+		t.scroll--
+	case '5':
+		t.keys.ReadByte()
+		t.scroll += page
+	case '6':
+		t.keys.ReadByte()
+		t.scroll -= page
+	}
+
+	if t.scroll > len(t.log)-page {
+		t.scroll = len(t.log) - page
+	}
+	if t.scroll < 0 {
+		t.scroll = 0
+	}
+}
+
+// waitForKey shows the final state of the game until a key is pressed.
+func (t *tui) waitForKey() {
+	t.prompt = "The game is over, press any key to quit."
+	t.readKey()
+}
+
+func terminalSize() (int, int) {
+	rows, cols := 24, 80
+
+	size, err := stty("size")
+	if err == nil {
+		fmt.Sscan(size, &rows, &cols)
+	}
+
+	return rows, cols
+}
+
+func (t *tui) logHeight() int {
+	t.mu.Lock()
+	rows, cols := t.rows, t.cols
+	t.mu.Unlock()
+
+	height := rows - len(t.board(cols)) - 2
+	if height < tuiMinLogHeight {
+		height = tuiMinLogHeight
+	}
+
+	return height
+}
+
+// board is the part of the screen above the log, with the players and the
+// market.
+func (t *tui) board(width int) []string {
+	var lines []string
+
+	for _, p := range plrs {
+		marker := ""
+		if currentTurn != nil && currentTurn.Roller == p {
+			marker = ansiBold + " <- turn" + ansiReset
+		}
+		lines = append(lines, fmt.Sprintf("%sPlayer %d%s  coins %d  invested %d%s", ansiBold, p.ID, ansiReset, p.Coins.Total(), p.Investment.Total(), marker))
+
+		for _, color := range tuiColorOrder {
+			var cards []string
+			for _, card := range market.Cards {
+				pc, ok := p.SupplyCards[card.Name]
+				if card.Color != color || !ok || pc.Total == 0 {
+					continue
+				}
+
+				closed := ""
+				if pc.Renovation > 0 {
+					closed = fmt.Sprintf(" %s(%d closed)%s", ansiDim, pc.Renovation, ansiReset)
+				}
+				cards = append(cards, fmt.Sprintf("%s x%d%s", card.Name, pc.Total, closed))
+			}
+			if len(cards) == 0 {
+				continue
+			}
+
+			lines = append(lines, fmt.Sprintf("  %s%-6s%s %s", cardColorCodes[color], color, ansiReset, strings.Join(cards, ", ")))
+		}
+
+		var landmarks []string
+		for _, landmark := range market.LandmarkCards {
+			if p.LandmarkCards[landmark.Name] {
+				landmarks = append(landmarks, ansiBold+"[x] "+landmark.Name+ansiReset)
+			} else {
+				landmarks = append(landmarks, ansiDim+"[ ] "+landmark.Name+ansiReset)
+			}
+		}
+		if len(landmarks) > 0 {
+			lines = append(lines, "  "+strings.Join(landmarks, " "))
+		}
+	}
+
+	if len(market.Cards) > 0 {
+		var cards []string
+		for _, cardCount := range market.Query().InStock().SortBy(byActiveNumber).Counts() {
+			card := cardCount.Card
+			cards = append(cards, fmt.Sprintf("%s%s%s %d$ (%d)", cardColorCodes[card.Color], card.Name, ansiReset, card.Cost, cardCount.Count))
+		}
+		lines = append(lines, ansiBold+"Market"+ansiReset)
+		lines = append(lines, wrapItems(cards, ", ", width-2, "  ")...)
+	}
+
+	return lines
+}
+
+// wrapItems joins the items into lines that fit the width.
+func wrapItems(items []string, sep string, width int, indent string) []string {
+	var lines []string
+	line := ""
+
+	for _, item := range items {
+		if line != "" && visibleLen(line)+len(sep)+visibleLen(item) > width {
+			lines = append(lines, indent+line+sep)
+			line = ""
+		}
+		if line != "" {
+			line += sep
+		}
+		line += item
+	}
+	if line != "" {
+		lines = append(lines, indent+line)
+	}
+
+	return lines
+}
+
+// visibleLen is the length of the text without escape sequences.
+func visibleLen(s string) int {
+	n := 0
+	escape := false
+
+	for _, r := range s {
+		switch {
+		case r == '\x1b':
+			escape = true
+		case escape:
+			escape = r != 'm'
+		default:
+			n++
+		}
+	}
+
+	return n
+}
+
+// fit cuts the text to the width, keeping escape sequences whole.
+func fit(s string, width int) string {
+	var b strings.Builder
+	n := 0
+	escape := false
+
+	for _, r := range s {
+		switch {
+		case r == '\x1b':
+			escape = true
+		case escape:
+			escape = r != 'm'
+		default:
+			if n == width {
+				return b.String() + ansiReset
+			}
+			n++
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// draw draws the screen, with the lock of the terminal size held.
+func (t *tui) draw() {
+	rows, cols := t.rows, t.cols
+	board := t.board(cols)
+
+	logHeight := rows - len(board) - 2
+	if logHeight < tuiMinLogHeight {
+		logHeight = tuiMinLogHeight
+		if rows-logHeight-2 < len(board) && rows-logHeight-2 >= 0 {
+			board = board[:rows-logHeight-2]
+		}
+	}
+
+	end := len(t.log) - t.scroll
+	start := end - logHeight
+	if start < 0 {
+		start = 0
+	}
+	logLines := t.log[start:end]
+
+	var screen []string
+	screen = append(screen, board...)
+	for i := len(logLines); i < logHeight; i++ {
+		screen = append(screen, "")
+	}
+	screen = append(screen, logLines...)
+
+	scrolled := ""
+	if t.scroll > 0 {
+		scrolled = fmt.Sprintf(" scrolled up %d lines ", t.scroll)
+	}
+	screen = append(screen, ansiDim+scrolled+strings.Repeat("-", cols)+ansiReset)
+
+	var b strings.Builder
+	b.WriteString(ansiClear)
+	for _, line := range screen {
+		b.WriteString(fit(line, cols))
+		b.WriteString("\r\n")
+	}
+	b.WriteString(fit(t.prompt+string(t.typed), cols))
+
+	fmt.Fprint(t.terminal, b.String())
+}
+
+// runTUI plays a game in the full-screen terminal interface.
+func runTUI(args []string) error {
+	ui, err := newTUI()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ui.Close()
+		input = os.Stdin
+		output = os.Stdout
+	}()
+
+	input = ui
+	output = ui
+	play := decide
+	decide = func(req decisionRequest) string {
+		ui.request = req
+		return play(req)
+	}
+	defer func() {
+		decide = play
+	}()
+
+	err = playMatch("tui")
+	if err == errGameQuit {
+		return nil
+	}
+	if err == nil {
+		ui.waitForKey()
+	}
+
+	return err
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"os"
+)
+
+// notifyResize does nothing, Windows has no signal for a resized terminal.
+func notifyResize(c chan<- os.Signal) {}
+
+func stopResize(c chan<- os.Signal) {}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+)
+
+// turn is the state of one player's turn. Landmark hooks read it and change it
+// to alter the turn, for example to allow rolling 2 dice or to ask for another
+// turn.
+type turn struct {
+	Roller    *player
+	DieChoice bool
+	DieCount  int
+	// Dice are the faces of the dice rolled and Roll the roll, which effects
+	// can change.
+	Dice    []int
+	Roll    int
+	Doubles bool
+	// Reroll is set by an after roll hook to roll again, Rerolled is set once
+	// the dice have been rolled again.
+	Reroll            bool
+	Rerolled          bool
+	CoinsBeforePayout int
+	Built             bool
+	ExtraTurn         bool
+}
+
+// takeTurn plays a whole turn of the player and reports if they won. The turn
+// is ended unless the player won.
+func takeTurn(version gameVersion, rlr *player) (*turn, bool) {
+	t := playTurn(version, rlr)
+
+	if version.Won(rlr) {
+		return t, true
+	}
+
+	pc, ok := rlr.SupplyCards["Tech Startup"]
+	if ok {
+		if pc.Total > 0 {
+			promptInvestment(rlr, pc.Total)
+		}
+	}
+
+	t.End()
+
+	return t, false
+}
+
+func playTurn(version gameVersion, rlr *player) *turn {
+	t := &turn{Roller: rlr}
+	currentTurn = t
+
+	fmt.Fprintf(output, "It's player %d's turn\n", rlr.ID)
+	announce(announcement{Kind: turnAnnouncement, Seat: rlr.ID})
+	printPlayerCards(rlr)
+
+	for {
+		t.DieChoice = version.FreeDieChoice
+		t.runHooks(beforeRollEvent)
+
+		dieCount, err := promptDieCount(t.DieChoice)
+		if err != nil {
+			fmt.Fprintln(output, err)
+			continue
+		}
+		t.DieCount = dieCount
+		t.Dice = rollDice(dieCount)
+		t.Roll, t.Doubles = sumRoll(t.Dice)
+		fmt.Fprintf(output, "Player %d rolls %d\n", rlr.ID, t.Roll)
+		t.announceRoll()
+
+		t.Reroll = false
+		t.runHooks(afterRollEvent)
+		if !t.Reroll {
+			break
+		}
+		t.Rerolled = true
+	}
+
+	// Card effects should be applied in priority order, first red cards, then
+	// green/blue cards, then purple cards.
+	cards := market.FindByRoll(t.Roll)
+	// This two dice roll is used for some card effects to determine payouts.  It
+	// should only be rolled once per roll.
+	specialRoll := rollSpecial()
+	t.CoinsBeforePayout = rlr.Coins.Total()
+	for priority := 0; priority < 3; priority++ {
+		for _, p := range counterClockwise(plrs, rlr) {
+			for _, card := range cards {
+				if card.Effect.Priority != priority {
+					continue
+				}
+				pc, ok := p.SupplyCards[card.Name]
+				if !ok {
+					continue
+				}
+				activateCard(*card, rlr, p, pc, specialRoll)
+			}
+		}
+	}
+
+	t.runHooks(beforeBuildEvent)
+
+	t.Built = promptSupplyCardPurchase(rlr)
+	if !t.Built {
+		t.Built = promptLandmarkCardPurchase(rlr)
+	}
+
+	t.runHooks(afterBuildEvent)
+
+	return t
+}
+
+// End runs the end of turn hooks, after the player had the chance to win.
+func (t *turn) End() {
+	t.runHooks(endOfTurnEvent)
+}
+
+// announcement is the start of a turn or a roll of the dice, for interfaces
+// that show them other than as the text of the output.
+type announcement struct {
+	Kind  string
+	Seat  int
+	Dice  []int
+	Total int
+}
+
+const (
+	turnAnnouncement = "turn"
+	rollAnnouncement = "roll"
+)
+
+// announceRoll announces the dice and the roll of the turn.
+func (t *turn) announceRoll() {
+	announce(announcement{Kind: rollAnnouncement, Seat: t.Roller.ID, Dice: t.Dice, Total: t.Roll})
+}
+
+// runHooks calls one hook of each landmark that applies to the roller, and
+// stops early when a hook asks for a re-roll.
+func (t *turn) runHooks(event turnEvent) {
+	for _, landmark := range appliedLandmarks(t.Roller) {
+		if t.Reroll {
+			return
+		}
+
+		if hook := landmark.Effect.Hook(event); hook != nil {
+			hook(landmark, t)
+		}
+	}
+}
+
+// activateCard applies a card's effect for the copies that are open. Copies
+// closed for renovation don't activate, instead they are reopened.
+func activateCard(card supplyCard, rlr *player, p *player, pc *playerCard, specialRoll int) {
+	c := pc.Active()
+
+	if reopened := pc.Reopen(); reopened > 0 {
+		fmt.Fprintf(output, "%d of Player %d's %s cards are reopened after renovation.\n", reopened, p.ID, card.Name)
+	}
+	if c > 0 {
+		card.Effect.Call(card, rlr, p, c, pc, specialRoll)
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+// webClientHTML is the browser client of the game server, a single page
+// without anything to load from elsewhere, so that it works on a LAN without
+// internet. It creates, joins and watches games in the lobby, and plays a game
+// over its WebSocket: the boards, the market and the dice are drawn from the
+// state and the events, and every kind of decision gets its own controls.
+const webClientHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Machi Koro</title>
+<style>
+  body { font-family: sans-serif; margin: 0; background: #f4f1ea; color: #222; }
+  header { background: #2d5d7b; color: #fff; padding: 8px 16px; }
+  header h1 { margin: 0; font-size: 20px; display: inline-block; }
+  header span { margin-left: 16px; }
+  main { padding: 16px; }
+  section { background: #fff; border-radius: 6px; padding: 12px; margin-bottom: 12px; box-shadow: 0 1px 2px rgba(0,0,0,.2); }
+  h2 { margin: 0 0 8px 0; font-size: 16px; }
+  button { margin: 2px; padding: 6px 10px; cursor: pointer; }
+  .hidden { display: none; }
+  #game { display: grid; grid-template-columns: 2fr 1fr; gap: 12px; }
+  .players { display: grid; grid-template-columns: repeat(auto-fit, minmax(240px, 1fr)); gap: 8px; }
+  .player { border: 2px solid #ccc; border-radius: 6px; padding: 8px; }
+  .player.turn { border-color: #e0a000; }
+  .player.me { background: #fffbe8; }
+  .card { display: inline-block; border-radius: 4px; padding: 2px 6px; margin: 2px; color: #fff; font-size: 13px; background: #777; }
+  .card.closed { opacity: .5; text-decoration: line-through; }
+  .landmark { display: inline-block; border: 1px solid #888; border-radius: 4px; padding: 2px 6px; margin: 2px; font-size: 13px; }
+  .dice { font-size: 48px; text-align: center; }
+  .dice small { display: block; font-size: 14px; color: #666; }
+  #log { height: 360px; overflow-y: auto; font-family: monospace; font-size: 12px; white-space: pre-wrap; }
+  #decision { border: 2px solid #2d5d7b; }
+  #decision.waiting { border-color: #ccc; }
+  .error { color: #b00; }
+</style>
+</head>
+<body>
+<header><h1>Machi Koro</h1><span id="where"></span></header>
+<main>
+  <div id="lobby">
+    <section>
+      <h2>New game</h2>
+      <label>Version <select id="version"></select></label>
+      <label>Time control <input id="clock" placeholder="30s or 10m+5s"></label>
+      <label>Spectator delay <input id="spectator-delay" placeholder="10 events or 30s"></label>
+      <div id="seats"></div>
+      <button id="add-seat">Add seat</button>
+      <button id="create">Create</button>
+      <div class="error" id="lobby-error"></div>
+    </section>
+    <section>
+      <h2>Games</h2>
+      <div id="games"></div>
+      <button id="refresh">Refresh</button>
+    </section>
+  </div>
+  <div id="game" class="hidden">
+    <div>
+      <section id="decision" class="waiting">
+        <h2 id="prompt">Waiting for the game</h2>
+        <div id="controls"></div>
+        <div class="error" id="game-error"></div>
+      </section>
+      <section><h2>Players</h2><div class="players" id="players"></div></section>
+      <section><h2>Market</h2><div id="market"></div></section>
+    </div>
+    <div>
+      <section><h2>Dice</h2><div class="dice" id="dice">-</div></section>
+      <section id="clock-section" class="hidden"><h2>Clocks</h2><div id="clocks"></div></section>
+      <section><h2>Events</h2><div id="log"></div></section>
+      <button id="leave">Back to the lobby</button>
+    </div>
+  </div>
+</main>
+<script>
+"use strict";
+
+var lobby = { bots: [] };
+var game = { id: null, seat: -1, socket: null, decision: null, state: null, turn: -1 };
+var diceFaces = ["", "⚀", "⚁", "⚂", "⚃", "⚄", "⚅"];
+
+function $(id) { return document.getElementById(id); }
+
+function el(tag, cls, text) {
+  var e = document.createElement(tag);
+  if (cls) { e.className = cls; }
+  if (text !== undefined) { e.textContent = text; }
+  return e;
+}
+
+function request(method, path, body, token) {
+  var headers = { "Content-Type": "application/json" };
+  if (token) { headers["Authorization"] = "Bearer " + token; }
+  return fetch(path, { method: method, headers: headers, body: body ? JSON.stringify(body) : undefined })
+    .then(function (r) {
+      return r.json().then(function (data) {
+        if (!r.ok) { throw new Error(data.error || r.statusText); }
+        return data;
+      });
+    });
+}
+
+function tokenKey(id) { return "machikoro-token-" + id; }
+
+// Lobby
+
+function seatRow(bot) {
+  var row = el("div");
+  var select = el("select");
+  select.appendChild(el("option", null, "Player"));
+  lobby.bots.forEach(function (name) {
+    var option = el("option", null, "Bot: " + name);
+    option.value = name;
+    select.appendChild(option);
+  });
+  select.value = bot || "Player";
+  var remove = el("button", null, "x");
+  remove.onclick = function () { if ($("seats").children.length > 2) { row.remove(); } };
+  row.appendChild(el("span", null, "Seat "));
+  row.appendChild(select);
+  row.appendChild(remove);
+  $("seats").appendChild(row);
+}
+
+function loadLobby() {
+  return request("GET", "/lobby").then(function (data) {
+    lobby = data;
+    var version = $("version");
+    if (!version.children.length) {
+      (data.versions || []).forEach(function (name) { version.appendChild(el("option", null, name)); });
+    }
+    if (!$("seats").children.length) { seatRow(); seatRow(); }
+
+    var games = $("games");
+    games.innerHTML = "";
+    if (!data.games.length) { games.textContent = "No games yet."; }
+    data.games.forEach(function (g) {
+      var row = el("div");
+      row.appendChild(el("span", null, "Game " + g.id + " (" + g.version + ")" + (g.result ? " - " + g.result : "") +
+        (g.spectators ? ", " + g.spectators + " watching" : "") + " "));
+      g.seats.forEach(function (seat, i) {
+        if (seat.bot) {
+          row.appendChild(el("span", null, "[" + seat.bot + "] "));
+        } else if (localStorage.getItem(tokenKey(g.id + "-" + i))) {
+          var back = el("button", null, "Play seat " + i + (seat.away ? " (played for you)" : ""));
+          back.onclick = function () { openGame(g.id, localStorage.getItem(tokenKey(g.id + "-" + i))); };
+          row.appendChild(back);
+        } else if (seat.joined) {
+          row.appendChild(el("span", null, "[" + (seat.name || "player") + (seat.connected ? "" : ", away") + "] "));
+        } else if (!g.result) {
+          var join = el("button", null, "Join seat " + i);
+          join.onclick = function () { joinGame(g.id, i); };
+          row.appendChild(join);
+        }
+      });
+      var watch = el("button", null, "Watch");
+      watch.onclick = function () { openGame(g.id, ""); };
+      row.appendChild(watch);
+      games.appendChild(row);
+    });
+  }).catch(function (err) { $("lobby-error").textContent = err.message; });
+}
+
+function createGame() {
+  var seats = [];
+  Array.prototype.forEach.call($("seats").querySelectorAll("select"), function (select) {
+    seats.push(select.value === "Player" ? {} : { bot: select.value });
+  });
+  request("POST", "/games", { version: $("version").value, seats: seats, clock: $("clock").value, spectator_delay: $("spectator-delay").value })
+    .then(function (g) {
+      var first = g.seats.findIndex(function (seat) { return !seat.bot; });
+      if (first === -1) { openGame(g.id, ""); } else { joinGame(g.id, first); }
+    })
+    .catch(function (err) { $("lobby-error").textContent = err.message; });
+}
+
+function joinGame(id, seat) {
+  request("POST", "/games/" + id + "/join", { seat: seat })
+    .then(function (data) {
+      localStorage.setItem(tokenKey(id + "-" + seat), data.token);
+      openGame(id, data.token);
+    })
+    .catch(function (err) { $("lobby-error").textContent = err.message; loadLobby(); });
+}
+
+// Game
+
+function openGame(id, token) {
+  closeGame();
+  game = { id: id, seat: -1, socket: null, decision: null, state: null, turn: -1 };
+  $("lobby").classList.add("hidden");
+  $("game").classList.remove("hidden");
+  $("log").textContent = "";
+  $("dice").textContent = "-";
+  $("players").innerHTML = "";
+  $("market").innerHTML = "";
+  showDecision(null);
+
+  var scheme = location.protocol === "https:" ? "wss://" : "ws://";
+  var socket = new WebSocket(scheme + location.host + "/games/" + id + "/ws?token=" + encodeURIComponent(token));
+  game.socket = socket;
+  socket.onmessage = function (e) { receive(JSON.parse(e.data)); };
+  // A lost connection is made again with the token, the game keeps the seat
+  // for the grace period of the server.
+  socket.onclose = function () {
+    if (game.socket !== socket || game.ended) { return; }
+    $("game-error").textContent = "The connection was lost, reconnecting...";
+    setTimeout(function () {
+      if (game.socket === socket) { openGame(id, token); }
+    }, 2000);
+  };
+}
+
+function closeGame() {
+  if (game.socket) {
+    var socket = game.socket;
+    game.socket = null;
+    socket.close();
+  }
+}
+
+function receive(msg) {
+  switch (msg.type) {
+  case "hello":
+    game.seat = msg.seat;
+    $("where").textContent = "Game " + msg.game.id + " (" + msg.game.version + "), " +
+      (msg.seat === -1 ? "watching" + (msg.game.spectator_delay ? " " + msg.game.spectator_delay + " behind" : "") : "playing seat " + msg.seat);
+    if (msg.game.state) { game.state = msg.game.state; drawState(); }
+    break;
+  case "event":
+    addEvent(msg.text);
+    break;
+  case "turn":
+    game.turn = msg.seat;
+    drawState();
+    break;
+  case "roll":
+    drawDice(msg.seat, msg.dice || [], msg.total);
+    break;
+  case "decision":
+    game.state = msg.state;
+    game.turn = msg.seat;
+    game.clock = msg.clock || null;
+    game.clockAt = Date.now();
+    drawClocks();
+    drawState();
+    showDecision(msg);
+    break;
+  case "error":
+    $("game-error").textContent = msg.text;
+    break;
+  case "end":
+    game.ended = true;
+    game.clock = null;
+    drawClocks();
+    showDecision(null);
+    $("prompt").textContent = msg.result === "won" ? "The game is over" : "The game ended: " + msg.result;
+    break;
+  }
+}
+
+function addEvent(text) {
+  var log = $("log");
+  var atBottom = log.scrollTop + log.clientHeight >= log.scrollHeight - 4;
+  log.appendChild(document.createTextNode(text + "\n"));
+  if (atBottom) { log.scrollTop = log.scrollHeight; }
+}
+
+function drawDice(player, faces, total) {
+  var dice = $("dice");
+  dice.innerHTML = "";
+  var shown = faces.map(function (face) { return diceFaces[face] || "[" + face + "]"; });
+  dice.appendChild(document.createTextNode(shown.join(" ")));
+  dice.appendChild(el("small", null, "Player " + player + " rolled " + total));
+}
+
+var colorStyles = { Blue: "#3a7bd5", Green: "#3a9d4b", Red: "#c0392b", Purple: "#8e44ad" };
+
+function cardColor(name) {
+  return colorStyles[(lobby.colors || {})[name]] || "#777";
+}
+
+function drawState() {
+  var state = game.state;
+  if (!state) { return; }
+
+  var players = $("players");
+  players.innerHTML = "";
+  (state.players || []).forEach(function (p, i) {
+    var box = el("div", "player" + (i === game.turn ? " turn" : "") + (i === game.seat ? " me" : ""));
+    box.appendChild(el("h2", null, "Player " + i + (i === game.seat ? " (you)" : "")));
+    box.appendChild(el("div", null, "Coins: " + p.coins + (p.investment ? ", invested: " + p.investment : "")));
+    var cards = el("div");
+    Object.keys(p.cards || {}).sort().forEach(function (name) {
+      var closed = (p.closed || {})[name] || 0;
+      var card = el("span", "card" + (closed ? " closed" : ""), name + " x" + p.cards[name] + (closed ? " (" + closed + " closed)" : ""));
+      card.style.background = cardColor(name);
+      cards.appendChild(card);
+    });
+    box.appendChild(cards);
+    var landmarks = el("div");
+    (p.landmarks || []).forEach(function (name) { landmarks.appendChild(el("span", "landmark", name)); });
+    box.appendChild(landmarks);
+    players.appendChild(box);
+  });
+
+  var market = $("market");
+  market.innerHTML = "";
+  Object.keys(state.market || {}).sort().forEach(function (name) {
+    if (!state.market[name]) { return; }
+    var card = el("span", "card", name + " (" + state.market[name] + ")");
+    card.style.background = cardColor(name);
+    market.appendChild(card);
+  });
+}
+
+function formatTime(seconds) {
+  seconds = Math.max(0, Math.ceil(seconds));
+  var s = seconds % 60;
+  return Math.floor(seconds / 60) + ":" + (s < 10 ? "0" : "") + s;
+}
+
+// drawClocks counts down the clock of the deciding player from the time the
+// clock was sent.
+function drawClocks() {
+  var clock = game.clock;
+  $("clock-section").classList.toggle("hidden", !clock);
+  if (!clock) { return; }
+
+  var elapsed = (Date.now() - game.clockAt) / 1000;
+  var clocks = $("clocks");
+  clocks.innerHTML = "";
+  clocks.appendChild(el("div", null, "Time control: " + clock.control));
+  (clock.remaining || []).forEach(function (remaining, i) {
+    var left = i === clock.seat ? remaining - elapsed : remaining;
+    clocks.appendChild(el("div", null, "Player " + i + ": " + formatTime(left)));
+  });
+  if (clock.seat !== -1) {
+    clocks.appendChild(el("div", null, "Player " + clock.seat + " has " + formatTime(clock.deadline - elapsed) + " to decide"));
+  }
+}
+
+function decide(value) {
+  if (!game.decision || !game.socket) { return; }
+  $("game-error").textContent = "";
+  game.socket.send(JSON.stringify({ id: game.decision.id, value: value }));
+  showDecision(null);
+}
+
+function showDecision(msg) {
+  var box = $("decision");
+  var controls = $("controls");
+  controls.innerHTML = "";
+  game.decision = null;
+
+  if (!msg) {
+    box.className = "waiting";
+    $("prompt").textContent = "Waiting for the other players";
+    return;
+  }
+  if (msg.seat !== game.seat) {
+    box.className = "waiting";
+    $("prompt").textContent = "Player " + msg.seat + ": " + msg.prompt;
+    return;
+  }
+
+  game.decision = msg;
+  box.className = "";
+  $("prompt").textContent = msg.prompt || "Your decision";
+  if (msg.menu) {
+    controls.appendChild(el("pre", null, msg.menu.join("\n")));
+  }
+
+  if (msg.kind === "bool") {
+    [["Yes", true], ["No", false]].forEach(function (answer) {
+      var button = el("button", null, answer[0]);
+      button.onclick = function () { decide(answer[1]); };
+      controls.appendChild(button);
+    });
+  } else if (msg.kind === "choice") {
+    (msg.choices || []).forEach(function (choice) {
+      var button = el("button", null, choice.label ? choice.label : String(choice.value));
+      button.onclick = function () { decide(choice.value); };
+      controls.appendChild(button);
+    });
+    if (msg.optional) {
+      var skip = el("button", null, "None");
+      skip.onclick = function () { decide(null); };
+      controls.appendChild(skip);
+    }
+  } else {
+    var text = el("input");
+    var send = el("button", null, "Send");
+    send.onclick = function () { decide(text.value); };
+    text.onkeydown = function (e) { if (e.key === "Enter") { decide(text.value); } };
+    controls.appendChild(text);
+    controls.appendChild(send);
+    text.focus();
+  }
+}
+
+$("add-seat").onclick = function () { if ($("seats").children.length < 4) { seatRow(); } };
+$("create").onclick = createGame;
+$("refresh").onclick = loadLobby;
+$("leave").onclick = function () {
+  closeGame();
+  $("game").classList.add("hidden");
+  $("lobby").classList.remove("hidden");
+  $("where").textContent = "";
+  loadLobby();
+};
+setInterval(drawClocks, 500);
+loadLobby();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// The WebSocket protocol (RFC 6455), as much of it as the game server needs:
+// text messages both ways, pings and closing. Messages of the clients are
+// small, so fragmented messages are joined but not streamed.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// maxWebsocketMessage is the size of the largest message a client can send.
+const maxWebsocketMessage = 64 * 1024
+
+var errWebsocketClosed = errors.New("The WebSocket was closed")
+
+type websocketConn struct {
+	conn net.Conn
+	in   *bufio.Reader
+
+	// mu guards writing, which is done by the reader for pongs too.
+	mu sync.Mutex
+}
+
+// upgradeWebsocket answers the opening handshake of a WebSocket and takes over
+// the connection of the request.
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request) (*websocketConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		return nil, errors.New("Not a WebSocket handshake")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("The connection can't be upgraded")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\n")
+	rw.WriteString("Connection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n\r\n")
+	if err = rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &websocketConn{conn: conn, in: rw.Reader}, nil
+}
+
+func headerContains(h http.Header, name string, value string) bool {
+	for _, field := range strings.Split(h.Get(name), ",") {
+		if strings.EqualFold(strings.TrimSpace(field), value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ws *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	if _, err := ws.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// WriteText sends a text message.
+func (ws *websocketConn) WriteText(msg []byte) error {
+	return ws.writeFrame(wsText, msg)
+}
+
+// ReadMessage reads the next text or binary message, answering pings on the
+// way. It returns errWebsocketClosed when the client closes the connection.
+func (ws *websocketConn) ReadMessage() ([]byte, error) {
+	var msg []byte
+
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case wsClose:
+			ws.writeFrame(wsClose, nil)
+			return nil, errWebsocketClosed
+		case wsPing:
+			ws.writeFrame(wsPong, payload)
+			continue
+		case wsPong:
+			continue
+		}
+
+		msg = append(msg, payload...)
+		if len(msg) > maxWebsocketMessage {
+			return nil, errors.New("The WebSocket message is too large")
+		}
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+func (ws *websocketConn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.in, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.in, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.in, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxWebsocketMessage {
+		return false, 0, nil, errors.New("The WebSocket message is too large")
+	}
+
+	// Frames of clients are always masked.
+	if !masked {
+		return false, 0, nil, errors.New("The WebSocket frame is not masked")
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.in, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.in, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+func (ws *websocketConn) Close() error {
+	ws.writeFrame(wsClose, nil)
+	return ws.conn.Close()
+}